@@ -155,6 +155,9 @@ func (c *Cli) AddSizesCommand(link PipelineLink) {
 			if err != nil {
 				return err
 			}
+			if c.isStructured() {
+				return c.writeStructured(sizes)
+			}
 			if !list {
 				c.Printf("Total %s\n", unitFormatter(sizes.Total))
 			} else {
@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	DEFAULT_PARALLEL = 2            //Default number of jobs in flight in batch mode
+	BATCH_MANIFEST   = "failed.txt" //File listing the inputs that failed in batch mode
+	BATCH_GLOB_CHARS = "*?["        //Characters that make an input a glob
+	BATCH_LIST_MARK  = "@"          //Prefix of the input files listing the batch files
+
+	BatchSummaryTemplate = `
+Input	Status	Job Id	Output
+{{range .}}{{.Input}}	{{.Status}}	{{.JobId}}	{{if .Error}}{{.Error}}{{else}}{{.Output}}{{end}}
+{{end}}`
+)
+
+//Runs a script once per file in the set given to one of its input ports
+type batchExecution struct {
+	jobExecution
+	parallel int //jobs in flight
+}
+
+//Result of processing one file of the batch
+type batchItem struct {
+	Input  string //input file
+	Output string //result folder (or zip file)
+	JobId  string
+	Status string
+	Error  error //client side error
+}
+
+//Returns true if the input value defines a set of files rather than a single one
+func isBatchSpec(value string) bool {
+	if strings.HasPrefix(value, BATCH_LIST_MARK) || strings.ContainsAny(value, BATCH_GLOB_CHARS) {
+		return true
+	}
+	info, err := os.Stat(value)
+	return err == nil && info.IsDir()
+}
+
+//Expands the set of files defined by the value of an input port:
+// - @FILE: the paths listed in FILE, one per line (empty lines and lines starting with # are ignored)
+// - DIRECTORY: all the files in the directory tree
+// - DIRECTORY/PATTERN: the files in the directory tree whose name matches the pattern
+// - any other glob is expanded as is
+func expandBatch(spec string) (files []string, err error) {
+	if strings.HasPrefix(spec, BATCH_LIST_MARK) {
+		return readBatchList(spec[len(BATCH_LIST_MARK):])
+	}
+	dir, pattern := filepath.Split(spec)
+	if info, err := os.Stat(spec); err == nil && info.IsDir() {
+		dir, pattern = spec, "*"
+	}
+	if strings.ContainsAny(dir, BATCH_GLOB_CHARS) {
+		files, err = filepath.Glob(spec)
+	} else {
+		if dir == "" {
+			dir = "."
+		}
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			match, err := filepath.Match(pattern, info.Name())
+			if match {
+				files = append(files, path)
+			}
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %v", spec)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+//Reads the list of files of a batch
+func readBatchList(path string) (files []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			files = append(files, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files listed in %v", path)
+	}
+	return
+}
+
+//Returns the name of the result folder for a batch file: its path relative to
+//the current directory, extension included so that book.xml and book.opf
+//don't share it. It doesn't depend on the rest of the batch, so retries end up
+//in the same place
+func batchOutputName(file string) string {
+	name := filepath.Clean(file)
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+		}
+	}
+	//files outside the current directory keep their full path
+	name = strings.TrimPrefix(name, filepath.VolumeName(name))
+	return strings.TrimLeft(name, string(filepath.Separator))
+}
+
+//Returns where the results of every file are stored. Fails if two files would
+//share the output, which can happen on file systems that ignore the case
+func (b batchExecution) batchOutputs(files []string) ([]string, error) {
+	outputs := make([]string, len(files))
+	seen := map[string]string{}
+	for idx, file := range files {
+		outputs[idx] = filepath.Join(b.output, batchOutputName(file))
+		if b.zipped {
+			outputs[idx] += ".zip"
+		}
+		key := strings.ToLower(outputs[idx])
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%v and %v would store their results in the same place (%v)", other, file, outputs[idx])
+		}
+		seen[key] = file
+	}
+	return outputs, nil
+}
+
+//Makes a copy of the request to be modified for a batch item
+func (r JobRequest) copy() *JobRequest {
+	req := newJobRequest()
+	req.Script, req.Nicename, req.Priority = r.Script, r.Nicename, r.Priority
+	req.Data, req.Background = r.Data, r.Background
+	for name, values := range r.Options {
+		req.Options[name] = append([]string{}, values...)
+	}
+	for name := range r.FileOptions {
+		req.FileOptions[name] = true
+	}
+	for name, values := range r.Inputs {
+		req.Inputs[name] = append([]url.URL{}, values...)
+	}
+	return req
+}
+
+func (b batchExecution) run(stdOut io.Writer) error {
+	if len(b.req.Batch) != 1 {
+		return errors.New("--batch needs exactly one input given as a glob, a directory or an @list of files")
+	}
+	if b.req.Background {
+		return errors.New("--background can't be used in batch mode")
+	}
+	if b.output == "" {
+		return errors.New("--output option is mandatory in batch mode")
+	}
+	var port, spec string
+	for port, spec = range b.req.Batch {
+		//just the one
+	}
+	files, err := expandBatch(spec)
+	if err != nil {
+		return err
+	}
+	outputs, err := b.batchOutputs(files)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdOut, "Running %v jobs, %v at a time\n", len(files), b.parallel)
+
+	items := make([]batchItem, len(files))
+	slots := make(chan bool, b.parallel)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	done := 0
+	for idx, file := range files {
+		wg.Add(1)
+		slots <- true
+		go func(idx int, file string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			items[idx] = b.runItem(port, file, outputs[idx])
+			mutex.Lock()
+			defer mutex.Unlock()
+			done++
+			fmt.Fprintf(stdOut, "[%v/%v] %v: %v\n", done, len(files), file, items[idx].Status)
+		}(idx, file)
+	}
+	wg.Wait()
+
+	if err := b.writeSummary(stdOut, items); err != nil {
+		return err
+	}
+	return b.writeManifest(stdOut, items)
+}
+
+//Runs the job for a single file of the batch, storing the results in output
+func (b batchExecution) runItem(port, file, output string) (item batchItem) {
+	item = batchItem{Input: file, Output: output}
+	exec := b.jobExecution
+	exec.output = item.Output
+	exec.req = b.req.copy()
+	if exec.req.Nicename == "" {
+		exec.req.Nicename = filepath.Base(file)
+	} else {
+		exec.req.Nicename += " (" + filepath.Base(file) + ")"
+	}
+	u, err := pathToUri(file, getBasePath(b.link.IsLocal()))
+	if err == nil {
+		exec.req.Inputs[port] = []url.URL{*u}
+		err = mkdir(filepath.Dir(item.Output))
+	}
+	if err == nil {
+		var job pipeline.Job
+		job, item.Status, err = exec.execute(ioutil.Discard)
+		item.JobId = job.Id
+	}
+	if err != nil {
+		item.Error = err
+		item.Status = "ERROR"
+	}
+	return
+}
+
+//Prints the table with the outcome of every file
+func (b batchExecution) writeSummary(stdOut io.Writer, items []batchItem) error {
+	tmpl := template.Must(template.New("batch").Parse(BatchSummaryTemplate))
+	if err := tmpl.Execute(stdOut, items); err != nil {
+		return err
+	}
+	succeeded := 0
+	for _, item := range items {
+		if item.Status == "SUCCESS" {
+			succeeded++
+		}
+	}
+	_, err := fmt.Fprintf(stdOut, "\n%v succeeded, %v failed\n", succeeded, len(items)-succeeded)
+	return err
+}
+
+//Writes the list of files that didn't succeed so they can be retried using
+//the manifest as input. The manifest from previous runs is removed if all the
+//files succeeded
+func (b batchExecution) writeManifest(stdOut io.Writer, items []batchItem) error {
+	path := filepath.Join(b.output, BATCH_MANIFEST)
+	failed := []string{}
+	results := []waitResult{}
+	for _, item := range items {
+		if item.Status != "SUCCESS" {
+			failed = append(failed, item.Input)
+		}
+		results = append(results, waitResult{Id: item.Input, Status: item.Status, Finished: true})
+	}
+	if len(failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := mkdir(b.output); err != nil {
+		return err
+	}
+	contents := "# " + fmt.Sprintf("%v files failed\n", len(failed)) + strings.Join(failed, "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdOut, "The failed inputs are listed in %v, use %v%v as input to retry them\n", path, BATCH_LIST_MARK, path)
+	return waitExitError(results)
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//Creates a directory tree with some files for the batch tests
+func createBatchTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dp2_batch_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, name := range []string{"a.xml", "b.txt", "sub/c.xml", "sub/deeper/d.xml"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("<doc/>"), 0644); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	return dir
+}
+
+func TestIsBatchSpec(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	for _, spec := range []string{dir, filepath.Join(dir, "*.xml"), "@list.txt", "file[12].xml"} {
+		if !isBatchSpec(spec) {
+			t.Errorf("%v should be a batch spec", spec)
+		}
+	}
+	if isBatchSpec(filepath.Join(dir, "a.xml")) {
+		t.Errorf("A single file is not a batch spec")
+	}
+}
+
+func TestExpandBatch(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	join := func(names ...string) (paths []string) {
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return
+	}
+	tests := []struct {
+		spec     string
+		expected []string
+	}{
+		{dir, join("a.xml", "b.txt", "sub/c.xml", "sub/deeper/d.xml")},
+		{filepath.Join(dir, "*.xml"), join("a.xml", "sub/c.xml", "sub/deeper/d.xml")},
+		{filepath.Join(dir, "s*", "*.xml"), join("sub/c.xml")},
+	}
+	for _, test := range tests {
+		files, err := expandBatch(test.spec)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(files, test.expected) {
+			t.Errorf("Wrong expansion of %v\n\tExpected: %v\n\tResult: %v", test.spec, test.expected, files)
+		}
+	}
+	if _, err := expandBatch(filepath.Join(dir, "*.html")); err == nil {
+		t.Errorf("Expected error when nothing matches")
+	}
+}
+
+func TestExpandBatchList(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "list.txt")
+	err := ioutil.WriteFile(list, []byte("# a comment\none.xml\n\n  two.xml\n"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	files, err := expandBatch("@" + list)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"one.xml", "two.xml"}) {
+		t.Errorf("Wrong list %v", files)
+	}
+	if _, err := expandBatch("@" + filepath.Join(dir, "notthere.txt")); err == nil {
+		t.Errorf("Expected error when the list doesn't exist")
+	}
+}
+
+func TestBatchOutputName(t *testing.T) {
+	name := batchOutputName(filepath.FromSlash("books/sub/book.xml"))
+	if name != filepath.FromSlash("books/sub/book.xml") {
+		t.Errorf("Wrong output name %v", name)
+	}
+	wd, _ := os.Getwd()
+	name = batchOutputName(filepath.Join(wd, "book.xml"))
+	if name != "book.xml" {
+		t.Errorf("Absolute paths inside the working dir should be relative %v", name)
+	}
+}
+
+//Checks that files with the same name but the extension get their own output,
+//and that sharing one is detected before sending anything
+func TestBatchOutputs(t *testing.T) {
+	b := batchExecution{jobExecution: jobExecution{output: "out", zipped: true}}
+	outputs, err := b.batchOutputs([]string{"book.xml", "book.opf", "book.dtbook.xml", "book.xml.dtbook"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if outputs[0] != filepath.Join("out", "book.xml.zip") || outputs[1] != filepath.Join("out", "book.opf.zip") || outputs[2] == outputs[3] {
+		t.Errorf("Wrong outputs %v", outputs)
+	}
+	if _, err := b.batchOutputs([]string{"book.xml", "Book.XML"}); err == nil || !strings.Contains(err.Error(), "same place") {
+		t.Errorf("Expected error for a shared output, got %v", err)
+	}
+}
+
+//Runs the script over a directory and checks the summary
+func TestScriptBatch(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	pipeline := newPipelineTest(false)
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	r := overrideOutput(cli)
+	link.pipeline.(*PipelineTest).withScripts = false
+	_, err = scriptToCommand(SCRIPT, cli, link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	single := filepath.Join(dir, "b.txt")
+	out := filepath.Join(dir, "out")
+	err = cli.Run([]string{"test", "--batch", "--parallel", "3", "-o", out, "--source", filepath.Join(dir, "*.xml"), "--single", single, "--test-opt", single})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	result := r.String()
+	if strings.Count(result, "SUCCESS") != 6 {
+		t.Errorf("Every file should be reported twice as SUCCESS\n%v", result)
+	}
+	if !strings.Contains(result, "3 succeeded, 0 failed") {
+		t.Errorf("Wrong summary\n%v", result)
+	}
+	if _, err := os.Stat(filepath.Join(out, BATCH_MANIFEST)); !os.IsNotExist(err) {
+		t.Errorf("The manifest shouldn't be written if nothing failed")
+	}
+}
+
+//Checks that directories are taken as they are and globs are rejected
+//without --batch
+func TestScriptBatchSpecWithoutBatch(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	overrideOutput(cli)
+	_, err = scriptToCommand(SCRIPT, cli, link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	single := filepath.Join(dir, "b.txt")
+	err = cli.Run([]string{"test", "-o", filepath.Join(dir, "out"), "--source", dir, "--single", single, "--test-opt", single})
+	if err != nil {
+		t.Errorf("Directories should be accepted as inputs %v", err)
+	}
+	cli, err = makeCli("test", link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	overrideOutput(cli)
+	if _, err = scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Error("Unexpected error")
+	}
+	err = cli.Run([]string{"test", "-o", filepath.Join(dir, "out2"), "--source", filepath.Join(dir, "*.xml"), "--single", single, "--test-opt", single})
+	if err == nil || !strings.Contains(err.Error(), "--batch") {
+		t.Errorf("Expected error not thrown %v", err)
+	}
+}
+
+//Checks that existing files that look like globs are not taken as sets of files
+func TestScriptGlobLikeFile(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "book[1].xml")
+	if err := ioutil.WriteFile(file, []byte("<book/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	overrideOutput(cli)
+	req, err := scriptToCommand(SCRIPT, cli, link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	err = cli.Run([]string{"test", "-o", filepath.Join(dir, "out"), "--source", file, "--single", file, "--test-opt", file})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(req.Inputs["single"]) != 1 {
+		t.Errorf("The file wasn't used as input %v", req.Inputs)
+	}
+}
+
+//Checks that the failed files are written to the manifest
+func TestBatchManifest(t *testing.T) {
+	dir := createBatchTree(t)
+	defer os.RemoveAll(dir)
+	b := batchExecution{jobExecution{output: dir}, 1}
+	items := []batchItem{
+		{Input: "ok.xml", Status: "SUCCESS"},
+		{Input: "ko.xml", Status: "FAIL"},
+	}
+	err := b.writeManifest(ioutil.Discard, items)
+	if ExitCode(err) != EXIT_JOB_FAIL {
+		t.Errorf("Expected FAIL exit code %v", err)
+	}
+	files, err := expandBatch("@" + filepath.Join(dir, BATCH_MANIFEST))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"ko.xml"}) {
+		t.Errorf("Wrong manifest %v", files)
+	}
+	//everything went fine the second time
+	items[1].Status = "SUCCESS"
+	if err := b.writeManifest(ioutil.Discard, items); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, BATCH_MANIFEST)); !os.IsNotExist(err) {
+		t.Errorf("The old manifest wasn't removed")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 	"text/template"
 	"regexp"
@@ -36,6 +35,7 @@ General commands:
 List of global options:                 {{.Name}} help -g
 List of admin commands:                 {{.Name}} help -a
 Detailed help for a single command:     {{.Name}} help COMMAND
+List of exit codes:                     {{.Name}} help exit-codes
 `
 	ADMIN_HELP_TEMPLATE = `
 Usage {{.Name}} [GLOBAL_OPTIONS] command [COMMAND_OPTIONS] [PARAMS]
@@ -98,39 +98,63 @@ Global Options:
 //the help display
 type Cli struct {
 	*subcommand.Parser
-	Scripts        []*ScriptCommand      //pipeline scripts
-	StaticCommands []*subcommand.Command //commands which are always present
-	AdminCommands  []*subcommand.Command //admin commands
-	Output         io.Writer             //writer where to dump the output
+	Scripts        []*ScriptCommand        //pipeline scripts
+	StaticCommands []*subcommand.Command   //commands which are always present
+	AdminCommands  []*subcommand.Command   //admin commands
+	Output         io.Writer               //writer where to dump the output
+	Input          io.Reader               //reader for the answers of the interactive commands
+	Format         string                  //output format (text, json or yaml)
+	profile        string                  //selected configuration profile
+	origins        map[string]configOrigin //where the configuration values come from, if not the defaults
+	unprofiled     Config                  //configuration before applying the profile
+	offline        map[string]bool         //commands that don't need the webservice
+	command        string                  //command being run
 }
 
 //Script commands have a job request associated
 type ScriptCommand struct {
 	*subcommand.Command
-	req *JobRequest
+	req    *JobRequest
+	loader func() error //adds the flags of a lazily loaded script, nil once they are there
 }
 
 //Creates a new CLI with a name and pipeline link to perform queries
 func NewCli(name string, link *PipelineLink) (cli *Cli, err error) {
 	cli = &Cli{
-		Parser: subcommand.NewParser(name),
-		Output: os.Stdout,
+		Parser:  subcommand.NewParser(name),
+		Output:  os.Stdout,
+		Input:   os.Stdin,
+		Format:  FORMAT_TEXT,
+		origins: make(map[string]configOrigin, len(fileOrigins)),
+		offline: make(map[string]bool),
+	}
+	for key, origin := range fileOrigins {
+		cli.origins[key] = origin
 	}
 	//set the help command
 	cli.setHelp()
+	refresh := false
 	//when the first command is processed
 	//initialise the link so we take into account the
 	//global configuration flags
 	cli.PostFlags(func() error {
+		if err = cli.applyProfile(link.config); err != nil {
+			return err
+		}
+		if err = cli.applyEnv(link.config); err != nil {
+			return err
+		}
+		if cli.offline[cli.command] {
+			return nil
+		}
 		if err = link.Init(); err != nil {
 			return err
 		}
-		scripts, err := link.Scripts()
+		scripts, err := link.ScriptList(refresh)
 		if err != nil {
-			fmt.Printf("Error loading scripts:\n\t%v\n", err)
-			os.Exit(-1)
+			return fmt.Errorf("Error loading scripts: %v", err)
 		}
-		cli.AddScripts(scripts, link)
+		cli.AddLazyScripts(scripts, link)
 		if !link.IsLocal() {
 			//it we are not in local mode we need to send the data
 			for _, cmd := range cli.Scripts {
@@ -143,6 +167,11 @@ func NewCli(name string, link *PipelineLink) (cli *Cli, err error) {
 	})
 	//add config flags
 	cli.addConfigOptions(link.config)
+	cli.addFormatOption()
+	cli.AddSwitch("refresh-scripts", "", "Reload the list of scripts from the webservice instead of using the cached one", func(string, string) error {
+		refresh = true
+		return nil
+	})
 	return
 }
 
@@ -173,46 +202,43 @@ func (c *Cli) addConfigOptions(conf Config) {
 	for option, desc := range config_descriptions {
 		c.AddOption(option, "", fmt.Sprintf("%v (default %v)", desc, conf[option]), "", "", func(optName string, value string) error {
 			log.Println("option:", optName, "value:", value)
-			switch conf[optName].(type) {
-			case int:
-				val, err := strconv.Atoi(value)
-				if err != nil {
-					return fmt.Errorf("option %v must be a numeric value (found %v)", optName, value)
-				}
-				conf[optName] = val
-			case bool:
-				switch {
-				case value == "true":
-					conf[optName] = true
-				case value == "false":
-					conf[optName] = false
-				default:
-					return fmt.Errorf("option %v must be true or false (found %v)", optName, value)
-				}
-
-			case string:
-				conf[optName] = value
-
+			if err := conf.SetString(optName, value); err != nil {
+				return err
 			}
+			c.origins[optName] = configOrigin{ORIGIN_FLAG, "--" + optName}
 			conf.UpdateDebug()
 			return nil
 		})
 	}
 	//alternative configuration file
 	c.AddOption("file", "f", "Alternative configuration file", "", "", func(string, filePath string) error {
-		file, err := os.Open(filePath)
-		if err != nil {
+		if _, err := os.Stat(filePath); err != nil {
 			log.Printf(err.Error())
 			return fmt.Errorf("File not found %v", filePath)
 		}
-		return conf.FromYaml(file)
+		keys, err := conf.fromYamlFile(filePath)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			c.origins[key] = configOrigin{ORIGIN_FILE, filePath}
+		}
+		return nil
+	}).SetCompletion(subcommand.Completion{Kind: subcommand.CompleteFiles})
+	c.AddOption("profile", "", fmt.Sprintf("Connection profile from the configuration file (default the value of %v)", PROFILE_ENV), "", "", func(name, profile string) error {
+		c.profile = profile
+		return nil
 	})
 }
 
 //Adds the command to the cli and stores the it into the scripts list
 func (c *Cli) AddScriptCommand(name, shortDesc string, longDesc string, fn func(string, ...string) error, request *JobRequest) *subcommand.Command {
-	cmd := c.Parser.AddCommand(name, shortDesc, longDesc, fn)
-	c.Scripts = append(c.Scripts, &ScriptCommand{cmd, request})
+	return c.addScriptCommand(name, shortDesc, longDesc, fn, request).Command
+}
+
+func (c *Cli) addScriptCommand(name, shortDesc string, longDesc string, fn func(string, ...string) error, request *JobRequest) *ScriptCommand {
+	cmd := &ScriptCommand{Command: c.Parser.AddCommand(name, shortDesc, longDesc, fn), req: request}
+	c.Scripts = append(c.Scripts, cmd)
 	return cmd
 }
 
@@ -254,8 +280,47 @@ func flagsToStrings(flags []subcommand.Flag) []string {
 
 //Runs the client
 func (c *Cli) Run(args []string) error {
+	if c.commandName(args) == "run" {
+		expanded, err := expandTemplate(args, c.commandIndex(args))
+		if err != nil {
+			return err
+		}
+		args = expanded
+	}
+	c.command = c.commandName(args)
 	_, err := c.Parser.Parse(args)
-	return err
+	return classifyError(err)
+}
+
+//Returns the name of the command in the arguments, skipping the global flags
+//and their values
+func (c Cli) commandName(args []string) string {
+	if idx := c.commandIndex(args); idx >= 0 {
+		return args[idx]
+	}
+	return ""
+}
+
+//Returns the position of the command in the arguments, -1 if there is none
+func (c Cli) commandIndex(args []string) int {
+	options := make(map[string]bool)
+	for _, flag := range c.Flags() {
+		if flag.Type == subcommand.Option {
+			options["--"+flag.Long] = true
+			if flag.Short != "" {
+				options["-"+flag.Short] = true
+			}
+		}
+	}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			return i
+		}
+		if options[args[i]] {
+			i++
+		}
+	}
+	return -1
 }
 
 //Prints using the client output
@@ -285,10 +350,21 @@ func printHelp(cli Cli, globals, admin, details bool, args ...string) error {
 		if len(args) > 2 {
 			return fmt.Errorf("help: only one or two parameters accepted. %v found (%v)", len(args), strings.Join(args, ","))
 		}
+		if args[0] == EXIT_CODES_TOPIC && len(args) == 1 {
+			printExitCodes(cli.Output)
+			return nil
+		}
 		cmd, ok := cli.Parser.Commands[args[0]]
 		if !ok {
 			return fmt.Errorf("help: command %v not found ", args[0])
 		}
+		for _, script := range cli.Scripts {
+			if script.Name == cmd.Name {
+				if err := script.load(); err != nil {
+					return err
+				}
+			}
+		}
 		if len(args) == 1 {
 			funcMap := template.FuncMap{
 				"flagAligner": aligner(flagsToStrings(cmd.Flags())),
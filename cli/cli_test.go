@@ -2,9 +2,12 @@ package cli
 
 import (
 	//"github.com/capitancambio/go-subcommand"
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/daisy/pipeline-clientlib-go"
@@ -269,6 +272,9 @@ func TestConfigOptions(t *testing.T) {
 		CLIENTKEY:    "rounded",
 		CLIENTSECRET: "he_likes_justin_beiber",
 		TIMEOUT:      3,
+		RETRIES:      5,
+		RETRYDELAY:   100,
+		MAXDATA:      20,
 		DEBUG:        true,
 		STARTING:     true,
 	}
@@ -281,6 +287,9 @@ func TestConfigOptions(t *testing.T) {
 		"--" + CLIENTKEY, exp[CLIENTKEY].(string),
 		"--" + CLIENTSECRET, exp[CLIENTSECRET].(string),
 		"--" + TIMEOUT, strconv.Itoa(exp[TIMEOUT].(int)),
+		"--" + RETRIES, strconv.Itoa(exp[RETRIES].(int)),
+		"--" + RETRYDELAY, strconv.Itoa(exp[RETRYDELAY].(int)),
+		"--" + MAXDATA, strconv.Itoa(exp[MAXDATA].(int)),
 		"--" + DEBUG, strconv.FormatBool(true),
 		"--" + STARTING, strconv.FormatBool(true),
 		"help",
@@ -344,3 +353,270 @@ func TestConfigFile(t *testing.T) {
 	tCompareCnfs(res, EXP, t)
 
 }
+
+func profilesConf(t *testing.T) Config {
+	conf := copyConf()
+	if err := conf.FromYaml(bytes.NewBufferString(PROFILES_YAML)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return conf
+}
+
+func TestCliProfile(t *testing.T) {
+	conf := profilesConf(t)
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: conf}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddJobsCommand(cli, *link)
+	//flags take precedence over the profile
+	err = cli.Run([]string{"--" + PORT, "9999", "--profile", "staging", "jobs"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if conf[HOST] != "http://staging.daisy.org" {
+		t.Errorf("The profile host wasn't applied (%v)", conf[HOST])
+	}
+	if conf[PORT] != 9999 {
+		t.Errorf("The port flag was overriden by the profile (%v)", conf[PORT])
+	}
+}
+
+func TestCliProfileEnv(t *testing.T) {
+	conf := profilesConf(t)
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: conf}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddJobsCommand(cli, *link)
+	os.Setenv(PROFILE_ENV, "production")
+	defer os.Unsetenv(PROFILE_ENV)
+	if err := cli.Run([]string{"jobs"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if conf[CLIENTKEY] != "prodkey" {
+		t.Errorf("The profile from %v wasn't applied", PROFILE_ENV)
+	}
+}
+
+func TestCliProfileNotFound(t *testing.T) {
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: profilesConf(t)}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddJobsCommand(cli, *link)
+	if err := cli.Run([]string{"--profile", "dev", "jobs"}); err == nil {
+		t.Errorf("Expected error for unknown profile")
+	}
+}
+
+func TestConfigProfilesCommand(t *testing.T) {
+	//the webservice is not needed
+	link := &PipelineLink{pipeline: newPipelineTest(true), config: profilesConf(t)}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddConfigCommand(cli, *link)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	if err := cli.Run([]string{"--profile", "staging", "config", "profiles"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	exp := "  production\thttp://daisy.org:8181/ws/\n* staging\thttp://staging.daisy.org:9000/ws/\n"
+	if buf.String() != exp {
+		t.Errorf("Wrong profile list\nexpected: %q\nresult:   %q", exp, buf.String())
+	}
+	if err := cli.Run([]string{"config", "colours"}); err == nil {
+		t.Errorf("Expected error for unknown action")
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: copyConf()}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	name := cli.commandName([]string{"--host", "http://daisy.org", "--format", "json", "-f", "conf.yml", "config", "profiles"})
+	if name != "config" {
+		t.Errorf("Wrong command name %v", name)
+	}
+}
+
+func TestCliEnvOverrides(t *testing.T) {
+	conf := profilesConf(t)
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: conf}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddJobsCommand(cli, *link)
+	os.Setenv("DP2_HOST", "http://env.daisy.org")
+	os.Setenv("DP2_PORT", "7000")
+	os.Setenv("DP2_DEBUG", "false")
+	defer os.Unsetenv("DP2_HOST")
+	defer os.Unsetenv("DP2_PORT")
+	defer os.Unsetenv("DP2_DEBUG")
+	err = cli.Run([]string{"--profile", "staging", "--" + PORT, "9999", "jobs"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//env over profile
+	if conf[HOST] != "http://env.daisy.org" {
+		t.Errorf("DP2_HOST wasn't applied (%v)", conf[HOST])
+	}
+	//flags over env
+	if conf[PORT] != 9999 {
+		t.Errorf("The port flag was overriden by DP2_PORT (%v)", conf[PORT])
+	}
+	if conf[DEBUG] != false {
+		t.Errorf("DP2_DEBUG wasn't applied (%v)", conf[DEBUG])
+	}
+}
+
+func TestCliEnvWrongValue(t *testing.T) {
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: copyConf()}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddJobsCommand(cli, *link)
+	os.Setenv("DP2_WS_TIMEUP", "abit")
+	defer os.Unsetenv("DP2_WS_TIMEUP")
+	err = cli.Run([]string{"jobs"})
+	if err == nil {
+		t.Fatalf("ws_timeup: non numeric type controll failed")
+	}
+	if !strings.Contains(err.Error(), "DP2_WS_TIMEUP") {
+		t.Errorf("The error doesn't name the variable: %v", err)
+	}
+}
+
+func TestConfigShowCommand(t *testing.T) {
+	conf := profilesConf(t)
+	conf[CLIENTSECRET] = "supersecret"
+	link := &PipelineLink{pipeline: newPipelineTest(true), config: conf}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddConfigCommand(cli, *link)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	os.Setenv("DP2_CLIENT_KEY", "envkey")
+	defer os.Unsetenv("DP2_CLIENT_KEY")
+	err = cli.Run([]string{"--profile", "staging", "--" + TIMEOUT, "3", "config", "show"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	lines := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		lines[strings.SplitN(line, "\t", 2)[0]] = line
+	}
+	exp := map[string]string{
+		HOST:         "host\thttp://staging.daisy.org\t(profile staging)",
+		CLIENTKEY:    "client_key\tenvkey\t(env DP2_CLIENT_KEY)",
+		CLIENTSECRET: "client_secret\t" + SECRET_MASK + "\t(default)",
+		TIMEOUT:      "timeout\t3\t(flag --timeout)",
+		PATH:         "ws_path\tws\t(default)",
+	}
+	for key, line := range exp {
+		if lines[key] != line {
+			t.Errorf("Wrong %v line\nexpected: %q\nresult:   %q", key, line, lines[key])
+		}
+	}
+}
+
+//Checks that set and unset keep the comments and the order of the file
+func TestEditUserConfigKeepsComments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dp2_config")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	ioutil.WriteFile(path, []byte(`#WS CONFIGURATION
+port: 8181
+host: http://localhost
+#connection settings
+timeout: 10
+#profiles:
+#  staging:
+#    host: http://staging.example.org
+`), 0644)
+	if found, err := editUserConfig(path, PORT, 9000); err != nil || !found {
+		t.Fatalf("Unexpected result %v %v", found, err)
+	}
+	if found, err := editUserConfig(path, TIMEOUT, nil); err != nil || !found {
+		t.Fatalf("Unexpected result %v %v", found, err)
+	}
+	if found, err := editUserConfig(path, DEBUG, true); err != nil || found {
+		t.Fatalf("Unexpected result %v %v", found, err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	exp := `#WS CONFIGURATION
+port: 9000
+host: http://localhost
+#connection settings
+#profiles:
+#  staging:
+#    host: http://staging.example.org
+debug: true
+`
+	if string(data) != exp {
+		t.Errorf("Wrong file\n%v", string(data))
+	}
+}
+
+func TestConfigSetGetUnset(t *testing.T) {
+	xdg, _, restore := withUserConfigDirs(t)
+	defer restore()
+	conf := copyConf()
+	link := &PipelineLink{pipeline: newPipelineTest(true), config: conf}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddConfigCommand(cli, *link)
+	if err := cli.Run([]string{"config", "set", PORT, "9000"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := cli.Run([]string{"config", "set", HOST, "http://daisy.org"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	saved := copyConf()
+	if _, err := saved.fromYamlFile(xdg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if saved[PORT] != 9000 || saved[HOST] != "http://daisy.org" {
+		t.Errorf("The values weren't stored %v", saved)
+	}
+	if err := cli.Run([]string{"config", "set", PORT, "ninethousand"}); err == nil {
+		t.Errorf("Port: non numeric type controll failed")
+	}
+	if err := cli.Run([]string{"config", "set", "colour", "blue"}); err == nil {
+		t.Errorf("Expected error for unknown key")
+	}
+	if err := cli.Run([]string{"config", "unset", PORT}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	keys, err := copyConf().fromYamlFile(xdg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(keys) != 1 || keys[0] != HOST {
+		t.Errorf("port wasn't removed")
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	if err := cli.Run([]string{"--" + PORT, "7000", "config", "get", PORT}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.String() != "7000\n" {
+		t.Errorf("Wrong value %q", buf.String())
+	}
+}
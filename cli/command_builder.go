@@ -19,6 +19,7 @@ type commandBuilder struct {
 	desc     string //Command description
 	linkCall call   //function to call in order to execute the command
 	template string //Name of the template used to print the output
+	multiIds bool   //The command accepts several job ids
 }
 
 //Creates a new commandBuilder
@@ -32,6 +33,12 @@ func (c *commandBuilder) withCall(fn call) *commandBuilder {
 	return c
 }
 
+//Makes the command built with buildWithId accept several job ids
+func (c *commandBuilder) withMultipleIds() *commandBuilder {
+	c.multiIds = true
+	return c
+}
+
 //Sets the template to be used as command output
 func (c *commandBuilder) withTemplate(template string) *commandBuilder {
 	c.template = template
@@ -41,28 +48,36 @@ func (c *commandBuilder) withTemplate(template string) *commandBuilder {
 //builds the commands and adds it to the cli
 func (c *commandBuilder) build(cli *Cli) (cmd *subcommand.Command) {
 	return cli.AddCommand(c.name, c.desc, func(name string, args ...string) error {
-
-		data, err := c.linkCall(args...)
-		if err != nil {
-			return err
-		}
-		return c.writeOutput(data, cli)
+		return c.execute(cli, args...)
 	})
 }
 
 //builds the commands and adds it to the cli
 func (c *commandBuilder) buildAdmin(cli *Cli) (cmd *subcommand.Command) {
 	return cli.AddAdminCommand(c.name, c.desc, func(name string, args ...string) error {
-
-		data, err := c.linkCall(args...)
-		if err != nil {
-			return err
-		}
-		return c.writeOutput(data, cli)
+		return c.execute(cli, args...)
 	})
 }
 
+//Calls the wrapped function and writes its output. Exit and job errors carry
+//the outcome of the command, so the output is written before returning them
+func (c commandBuilder) execute(cli *Cli, args ...string) error {
+	data, err := c.linkCall(args...)
+	switch err.(type) {
+	case nil, ExitError, JobError:
+	default:
+		return err
+	}
+	if outErr := c.writeOutput(data, cli); outErr != nil {
+		return outErr
+	}
+	return err
+}
+
 func (c commandBuilder) writeOutput(data interface{}, cli *Cli) error {
+	if data != nil && cli.isStructured() {
+		return cli.writeStructured(data)
+	}
 	funcs := template.FuncMap{
 		"printAsPercentage": func(val float64) string {
 			return fmt.Sprintf("%.1f%%", val * 100)
@@ -82,17 +97,24 @@ func (c commandBuilder) writeOutput(data interface{}, cli *Cli) error {
 func (c *commandBuilder) buildWithId(cli *Cli) (cmd *subcommand.Command) {
 	lastId := new(bool)
 	cmd = cli.AddCommand(c.name, c.desc, func(command string, args ...string) error {
-		id, err := checkId(*lastId, command, args...)
-		if err != nil {
-			return err
+		var ids []string
+		var err error
+		if c.multiIds {
+			ids, err = checkIds(*lastId, command, args...)
+		} else {
+			var id string
+			id, err = checkId(*lastId, command, args...)
+			ids = []string{id}
 		}
-		data, err := c.linkCall(id)
 		if err != nil {
 			return err
 		}
-		return c.writeOutput(data, cli)
+		return c.execute(cli, ids...)
 	})
 
 	addLastId(cmd, lastId)
+	if c.multiIds {
+		cmd.SetArity(-1, "[JOB_ID...]")
+	}
 	return
 }
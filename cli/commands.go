@@ -1,10 +1,18 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/capitancambio/go-subcommand"
 	"github.com/daisy/pipeline-clientlib-go"
 )
 
@@ -15,8 +23,7 @@ Status: {{.Data.Status}}
 {{if .Running}}Progress: {{.Data.Messages.Progress | printAsPercentage}}
 {{end}}Priority: {{.Data.Priority}}
 {{if .Verbose}}Messages:
-{{range .Data.Messages.Message}}
-[{{.Level}}]	{{.Content}}
+{{range .Messages}}{{.}}
 {{end}}
 {{end}}
 `
@@ -31,6 +38,9 @@ Pipeline version:               {{.Version}}
 Pipeline authentication:        {{.Authentication}}
 `
 
+	WaitTemplate = `{{range .}}Job {{.Id}} {{if .Finished}}finished with status{{else}}did not finish in time, status{{end}} {{.Status}}
+{{end}}`
+
 	QueueTemplate = `Job Id 			Priority	Job P.	 Client P.	Rel.Time.	 Since
 {{range .}}{{.Id}}	{{.ComputedPriority | printf "%.2f"}}	{{.JobPriority}}	{{.ClientPriority}}	{{.RelativeTime | printf "%.2f"}}	{{.TimeStamp}}
 {{end}}`
@@ -38,9 +48,15 @@ Pipeline authentication:        {{.Authentication}}
 
 //Convinience struct for printing jobs
 type printableJob struct {
-	Data    pipeline.Job
-	Verbose bool
-	Running bool
+	Data     pipeline.Job
+	Verbose  bool
+	Running  bool
+	Messages []string //the messages selected, as printed while following the job
+}
+
+//Only the job is serialised in machine-readable formats
+func (p printableJob) rawData() interface{} {
+	return p.Data
 }
 
 func AddJobStatusCommand(cli *Cli, link PipelineLink) {
@@ -49,7 +65,21 @@ func AddJobStatusCommand(cli *Cli, link PipelineLink) {
 		Verbose: false,
 		Running: false,
 	}
+	follow := false
+	filter := &messageFilter{}
 	fn := func(args ...string) (interface{}, error) {
+		if follow {
+			//don't mix messages with machine-readable output
+			show := !cli.isStructured()
+			detach, stop := detachOnInterrupt()
+			_, detached, err := followJob(cli.Output, link, args[0], show, *filter, show, detach)
+			stop()
+			if err != nil || detached {
+				return nil, err
+			}
+			//the messages have already been printed
+			printable.Verbose = printable.Verbose && !show
+		}
 		job, err := link.Job(args[0])
 		if err != nil {
 			return nil, err
@@ -58,6 +88,12 @@ func AddJobStatusCommand(cli *Cli, link PipelineLink) {
 		if (job.Status == "RUNNING") {
 			printable.Running = true
 		}
+		if printable.Verbose {
+			color := isTerminal(cli.Output)
+			for _, msg := range filter.jobMessages(job) {
+				printable.Messages = append(printable.Messages, msg.format(color))
+			}
+		}
 		return printable, nil
 	}
 	cmd := newCommandBuilder("status", "Returns the status of the job with id JOB_ID").
@@ -68,6 +104,50 @@ func AddJobStatusCommand(cli *Cli, link PipelineLink) {
 		printable.Verbose = true
 		return nil
 	})
+	cmd.AddSwitch("follow", "", "Prints the job's messages and progress until it finishes, Ctrl-C stops following without deleting the job", func(string, string) error {
+		follow = true
+		return nil
+	})
+	filter.addFlags(cmd, nil)
+}
+
+//Prints the messages of the job, from the first one, as they come until the
+//job finishes or detach fires. Detaching leaves the job running on the server.
+//Returns the status in which the job finished
+func followJob(out io.Writer, link PipelineLink, id string, verbose bool, filter messageFilter, progressBar bool, detach <-chan struct{}) (status string, detached bool, err error) {
+	stop := make(chan struct{})
+	defer close(stop)
+	status, err = printMessages(out, link.Follow(id, stop), verbose, filter, progressBar, nil, detach)
+	if progressBar {
+		fmt.Fprintln(out)
+	}
+	if err == errDetached {
+		fmt.Fprintf(out, "Detached from job %v, it keeps running on the server\n", id)
+		return status, true, nil
+	}
+	return
+}
+
+//Returns a channel that is closed when the user hits Ctrl-C, which doesn't kill
+//the process until stop is called or Ctrl-C is hit again
+func detachOnInterrupt() (detach <-chan struct{}, stop func()) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	fire := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupt:
+			signal.Reset(os.Interrupt)
+			close(fire)
+		case <-done:
+		}
+	}()
+	return fire, func() {
+		signal.Stop(interrupt)
+		signal.Reset(os.Interrupt)
+		close(done)
+	}
 }
 
 func AddDeleteCommand(cli *Cli, link PipelineLink) {
@@ -86,14 +166,15 @@ func AddDeleteCommand(cli *Cli, link PipelineLink) {
 func AddResultsCommand(cli *Cli, link PipelineLink) {
 	outputPath := ""
 	zipped := false
+	policy := EXISTS_DEFAULT
 	cmd := newCommandBuilder("results", "Stores the results from a job").
 		withCall(func(args ...string) (v interface{}, err error) {
 
-		wc, err := zipProcessor(outputPath, zipped)
+		wc, err := zipProcessor(outputPath, zipped, policy)
 		if err != nil {
 			return
 		}
-		ok, err := link.Results(args[0], wc)
+		ok, err := link.DownloadResults(args[0], wc, progressOutput())
 		if err != nil {
 			return
 		}
@@ -120,14 +201,27 @@ func AddResultsCommand(cli *Cli, link PipelineLink) {
 		zipped = true
 		return nil
 	}).Must(false)
+	addExistsPolicySwitches(cmd, &policy, nil)
 }
 
 func AddLogCommand(cli *Cli, link PipelineLink) {
 	outputPath := ""
+	follow := false
+	format := ""
+	filter := &messageFilter{}
 	fn := func(vals ...string) (ret interface{}, err error) {
-		data, err := link.Log(vals[0])
-		if err != nil {
-			return
+		if follow && format != "" {
+			return nil, errors.New("--format can't be combined with --follow")
+		}
+		var data []byte
+		//the log file can't be filtered nor structured, the job messages are
+		//printed instead
+		fromMessages := filter.filters() || format != ""
+		if !follow && !fromMessages {
+			data, err = link.Log(vals[0])
+			if err != nil {
+				return
+			}
 		}
 		outWriter := cli.Output
 		if len(outputPath) > 0 {
@@ -141,6 +235,29 @@ func AddLogCommand(cli *Cli, link PipelineLink) {
 			}
 			outWriter = file
 		}
+		if follow {
+			detach, stop := detachOnInterrupt()
+			defer stop()
+			_, _, err = followJob(outWriter, link, vals[0], true, *filter, false, detach)
+			return ret, err
+		}
+		if fromMessages {
+			job, err := link.Job(vals[0])
+			if err != nil {
+				return ret, err
+			}
+			switch format {
+			case LOG_FORMAT_JSONL:
+				return ret, writeJSONLines(outWriter, filter.jobMessages(job))
+			case LOG_FORMAT_JUNIT:
+				return ret, writeJUnit(outWriter, job, filter.jobMessages(job))
+			}
+			color := isTerminal(outWriter)
+			for _, msg := range filter.jobMessages(job) {
+				fmt.Fprintf(outWriter, "%v\n", msg.format(color))
+			}
+			return ret, nil
+		}
 		_, err = outWriter.Write(data)
 		return ret, err
 	}
@@ -151,6 +268,20 @@ func AddLogCommand(cli *Cli, link PipelineLink) {
 		outputPath = file
 		return nil
 	})
+	cmd.AddSwitch("follow", "", "Prints the job's messages as they come until it finishes, Ctrl-C stops following without deleting the job", func(string, string) error {
+		follow = true
+		return nil
+	})
+	cmd.AddOption("format", "", "Writes the job's messages as json lines (jsonl) or as a JUnit report (junit) instead of the log", "", "(jsonl|junit)", func(name, value string) error {
+		for _, f := range logFormats {
+			if f == value {
+				format = value
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not a valid log format. Allowed values are %v", value, strings.Join(logFormats, ", "))
+	}).SetCompletion(subcommand.Completion{Values: logFormats})
+	filter.addFlags(cmd, nil)
 }
 
 func AddHaltCommand(cli *Cli, link PipelineLink) {
@@ -169,10 +300,53 @@ func AddHaltCommand(cli *Cli, link PipelineLink) {
 }
 
 func AddJobsCommand(cli *Cli, link PipelineLink) {
-	newCommandBuilder("jobs", "Returns the list of jobs present in the server").
+	filter := jobFilter{}
+	sortBy := ""
+	limit := 0
+	cmd := newCommandBuilder("jobs", "Returns the list of jobs present in the server").
 		withCall(func(...string) (interface{}, error) {
-		return link.Jobs()
+		timeFlag := filter.timeFlag
+		if strings.TrimPrefix(sortBy, "-") == "time" {
+			timeFlag = "--sort time"
+		}
+		if err := filter.checkTimes(timeFlag); err != nil {
+			return nil, err
+		}
+		jobs, err := link.Jobs()
+		if err != nil {
+			return nil, err
+		}
+		times := map[string]time.Time{}
+		if filter.needsTimes() || strings.TrimPrefix(sortBy, "-") == "time" {
+			if times, err = link.JobTimes(); err != nil {
+				return nil, err
+			}
+		}
+		jobs = filterJobs(jobs, filter.predicate(times))
+		if sortBy != "" {
+			sortJobs(jobs, sortBy, times)
+		}
+		if limit > 0 && len(jobs) > limit {
+			jobs = jobs[:limit]
+		}
+		return jobs, nil
 	}).withTemplate(JobListTemplate).build(cli)
+	filter.addFlags(cmd)
+	cmd.AddOption("sort", "", "Sorts the jobs by id, status, nicename, script, priority or time (needs --status IDLE), prefix it with - for a descending order", "", "FIELD", func(name, value string) error {
+		if err := checkSortField(value); err != nil {
+			return err
+		}
+		sortBy = value
+		return nil
+	})
+	cmd.AddOption("limit", "", "Shows at most that many jobs", "", "N", func(name, value string) (err error) {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return fmt.Errorf("--limit must be a positive number (found %v)", value)
+		}
+		return nil
+	})
+	cmd.SetArity(0, "")
 }
 
 func AddQueueCommand(cli *Cli, link PipelineLink) {
@@ -208,6 +382,15 @@ type Version struct {
 	CliVersion string
 }
 
+//Serialises the client and framework versions only
+func (v Version) rawData() interface{} {
+	return struct {
+		CliVersion     string
+		Version        string
+		Authentication bool
+	}{v.CliVersion, v.PipelineLink.Version, v.Authentication}
+}
+
 func AddVersionCommand(cli *Cli, link *PipelineLink) {
 	newCommandBuilder("version", "Prints the version and authentication information").
 		withCall(func(...string) (interface{}, error) {
@@ -216,30 +399,191 @@ func AddVersionCommand(cli *Cli, link *PipelineLink) {
 
 }
 
+const (
+	CLEAN_CONFIRM_ABOVE = 10 //Number of jobs clean removes without asking for confirmation
+	CLEAN_PARALLEL      = 4  //Number of jobs clean removes at the same time
+)
+
+//Returns the writer where clean asks for confirmation, stderr if the answers
+//are read from a terminal and nil if they can't be asked
+var promptOutput = func(in io.Reader) io.Writer {
+	if !isTerminal(in) {
+		return nil
+	}
+	return os.Stderr
+}
+
 func AddCleanCommand(cli *Cli, link PipelineLink) {
-	pred := isError
+	filter := jobFilter{}
+	done := false
+	dryRun := false
+	yes := false
 	fn := func(args ...string) (interface{}, error) {
+		//ERROR jobs unless other statuses are given
+		if len(filter.statuses) == 0 {
+			filter.statuses = []string{"ERROR"}
+		}
+		if done {
+			filter.statuses = append(filter.statuses, "SUCCESS")
+		}
+		if err := filter.checkTimes(filter.timeFlag); err != nil {
+			return "", err
+		}
 		jobs, err := link.Jobs()
 		if err != nil {
 			return "", err
 		}
+		times := map[string]time.Time{}
+		if filter.needsTimes() {
+			if times, err = link.JobTimes(); err != nil {
+				return "", err
+			}
+		}
+		selected := filterJobs(jobs, filter.predicate(times))
+		if dryRun {
+			msgs := []string{}
+			for _, j := range selected {
+				msgs = append(msgs, fmt.Sprintf("Job %v would be removed from the server\n", j.Id))
+			}
+			return strings.Join(msgs, ""), nil
+		}
+		if len(selected) > CLEAN_CONFIRM_ABOVE && !yes {
+			out := promptOutput(cli.Input)
+			if out == nil {
+				return "", fmt.Errorf("%v jobs would be removed from the server, give --yes to confirm it as the input is not a terminal", len(selected))
+			}
+			w := &wizard{in: bufio.NewReader(cli.Input), out: out}
+			ok, err := w.confirm(fmt.Sprintf("%v jobs will be removed from the server, continue?", len(selected)))
+			if err != nil || !ok {
+				return "", errors.New("No job was removed")
+			}
+		}
+		failed := int32(0)
 		deleteFn := func(j pipeline.Job, c chan string) {
 			ok, err := link.Delete(j.Id)
 			if err == nil && ok {
 				c <- fmt.Sprintf("Job %v removed from the server\n", j.Id)
 			} else {
+				atomic.AddInt32(&failed, 1)
 				c <- fmt.Sprintf("Couldn't remove Job %v from the server (%v)\n", j.Id, err)
 			}
 		}
-		msgs := parallelMap(jobs, deleteFn, pred)
+		msgs := boundedMap(selected, deleteFn, and(), CLEAN_PARALLEL)
+		if failed > 0 {
+			return strings.Join(msgs, ""), ExitError{EXIT_FAILURE, fmt.Sprintf("%v of %v jobs couldn't be removed", failed, len(selected))}
+		}
 		return strings.Join(msgs, ""), nil
 
 	}
-	cmd := newCommandBuilder("clean", "Removes the jobs with an ERROR status").
+	cmd := newCommandBuilder("clean", "Removes the jobs with an ERROR status, or the ones selected by the filters").
 		withCall(fn).build(cli)
-	cmd.AddSwitch("done", "d", "Removes also the jobs with a DONE status", func(string, string) error {
-		pred = or(pred, isDone)
+	cmd.AddSwitch("done", "d", "Removes also the jobs with a SUCCESS status", func(string, string) error {
+		done = true
+		return nil
+	})
+	filter.addFlags(cmd)
+	cmd.AddSwitch("dry-run", "", "Lists the jobs that would be removed without removing them", func(string, string) error {
+		dryRun = true
+		return nil
+	})
+	cmd.AddSwitch("yes", "y", fmt.Sprintf("Doesn't ask for confirmation when more than %v jobs are removed", CLEAN_CONFIRM_ABOVE), func(string, string) error {
+		yes = true
 		return nil
 	})
 	cmd.SetArity(0, "")
 }
+
+//Outcome of waiting for a job
+type waitResult struct {
+	Id       string
+	Status   string
+	Finished bool
+}
+
+//Returns the exit error corresponding to the jobs' outcome, nil if all of them succeeded
+func waitExitError(results []waitResult) error {
+	failed := map[string][]string{}
+	for _, res := range results {
+		status := res.Status
+		if !res.Finished {
+			status = "TIMEOUT"
+		}
+		if status != "SUCCESS" {
+			failed[status] = append(failed[status], res.Id)
+		}
+	}
+	//the worst outcome defines the exit code
+	if ids, ok := failed["TIMEOUT"]; ok {
+		return ExitError{EXIT_TIMEOUT, fmt.Sprintf("Timeout while waiting for %v", strings.Join(ids, ", "))}
+	}
+	if ids, ok := failed["ERROR"]; ok {
+		return JobError{ids, "ERROR"}
+	}
+	if ids, ok := failed["FAIL"]; ok {
+		return JobError{ids, "FAIL"}
+	}
+	return nil
+}
+
+//Parses a duration either as a number of seconds or as a go duration (1h30m)
+func parseTimeout(value string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func AddWaitCommand(cli *Cli, link PipelineLink) {
+	verbose := false
+	var timeout time.Duration
+	fn := func(ids ...string) (interface{}, error) {
+		var deadline <-chan time.Time
+		if timeout > 0 {
+			deadline = time.After(timeout)
+		}
+		//don't mix messages with machine-readable output
+		follow := verbose && !cli.isStructured()
+		results := []waitResult{}
+		timedOut := false
+		for _, id := range ids {
+			res := waitResult{Id: id}
+			if !timedOut {
+				stop := make(chan struct{})
+				status, err := printMessages(cli.Output, link.Follow(id, stop), follow, messageFilter{}, follow, deadline, nil)
+				close(stop)
+				if follow {
+					fmt.Fprintln(cli.Output)
+				}
+				if err != nil && err != errTimeout {
+					return nil, err
+				}
+				timedOut = err == errTimeout
+				res.Status, res.Finished = status, !timedOut
+			} else {
+				//just check if it's done
+				job, err := link.Job(id)
+				if err != nil {
+					return nil, err
+				}
+				res.Status = job.Status
+				res.Finished = isFinished(job)
+			}
+			results = append(results, res)
+		}
+		return results, waitExitError(results)
+	}
+	cmd := newCommandBuilder("wait", "Waits until the jobs are finished").
+		withCall(fn).withTemplate(WaitTemplate).withMultipleIds().buildWithId(cli)
+
+	cmd.AddSwitch("verbose", "v", "Prints the job's messages and progress while waiting", func(string, string) error {
+		verbose = true
+		return nil
+	})
+	cmd.AddOption("timeout", "t", "Maximum time to wait, in seconds or as a duration (e.g. 1h30m)", "", italic("TIMEOUT"), func(name, value string) (err error) {
+		timeout, err = parseTimeout(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("%s is not a valid timeout", value)
+		}
+		return nil
+	})
+}
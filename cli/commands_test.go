@@ -1,14 +1,19 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/daisy/pipeline-clientlib-go"
 )
@@ -206,6 +211,24 @@ func TestLogCommandError(t *testing.T) {
 	}
 }
 
+//Checks that log --follow streams the messages instead of fetching the log
+func TestLogCommandFollow(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddLogCommand(cli, link)
+	err := cli.Run([]string{"log", "--follow", "job1"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if getCall(link) != JOB_CALL {
+		t.Errorf("The log was fetched")
+	}
+	expected := "[INFO]     Message 1\n[DEBUG]    Message 2\n[WARN]     Message 3\n"
+	if r.String() != expected {
+		t.Errorf("Wrong messages %q", r.String())
+	}
+}
+
 //Tests the log command when there is a writing error
 func TestLogCommandWritingError(t *testing.T) {
 	cli, link, _ := makeReturningCli(nil, t)
@@ -267,7 +290,7 @@ func TestVerboseJobStatusCommand(t *testing.T) {
 	if getCall(link) != JOB_CALL {
 		t.Errorf("status wasn't called")
 	}
-	exp := regexp.MustCompile("\\[\\w+\\]\\t\\w+")
+	exp := regexp.MustCompile("\\[\\w+\\] +\\w+")
 	matches := exp.FindAll(r.Bytes(), -1)
 	if len(matches) != 2 {
 		t.Errorf("The messages weren't printed output:\n%s", string(string(r.Bytes())))
@@ -275,6 +298,55 @@ func TestVerboseJobStatusCommand(t *testing.T) {
 
 }
 
+//Checks that the messages are replayed and streamed until the job finishes
+func TestJobStatusCommandFollow(t *testing.T) {
+	cli, link, p := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	err := cli.Run([]string{"status", "--follow", "-v", "job1"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if p.count < 3 {
+		t.Errorf("The job wasn't polled until it finished")
+	}
+	out := r.String()
+	for _, exp := range []string{"[INFO]     Message 1", "[DEBUG]    Message 2", "[WARN]     Message 3", "Status: SUCCESS"} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("%q not found in the output\n%v", exp, out)
+		}
+	}
+	if strings.Count(out, "Message 3") != 1 {
+		t.Errorf("Messages printed twice\n%v", out)
+	}
+}
+
+//Checks that detaching stops following without deleting the job
+func TestFollowJobDetach(t *testing.T) {
+	_, link, p := makeReturningCli(nil, t)
+	deleted := false
+	p.delete = func(string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	detach := make(chan struct{})
+	close(detach)
+	var buf bytes.Buffer
+	_, detached, err := followJob(&buf, link, "job1", true, messageFilter{}, false, detach)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !detached {
+		t.Errorf("The job wasn't detached")
+	}
+	if deleted {
+		t.Errorf("The job was deleted")
+	}
+	if !strings.Contains(buf.String(), "Detached from job job1") {
+		t.Errorf("Detaching not reported %q", buf.String())
+	}
+}
+
 //Checks that the error is propagated when the link errors when calling status
 func TestJobStatusCommandError(t *testing.T) {
 	//as mocking logic is more complex for jobs
@@ -625,8 +697,8 @@ func TestCleanErrors(t *testing.T) {
 	r := overrideOutput(cli)
 	AddCleanCommand(cli, link)
 	err := cli.Run([]string{"clean"})
-	if err != nil {
-		t.Errorf("Unexpected error %v", err)
+	if ExitCode(err) != EXIT_FAILURE {
+		t.Errorf("Expected failure exit code, got %v (%v)", ExitCode(err), err)
 	}
 	if !jobsCalled {
 		t.Errorf("Jobs wasn't called")
@@ -640,3 +712,265 @@ func TestCleanErrors(t *testing.T) {
 		t.Errorf("The message is not correct '%s'!='%s'", expected, result)
 	}
 }
+
+//Builds a clean command over the jobs, returns the ids deleted
+func makeCleanCli(jobs []pipeline.Job, queue []pipeline.QueueJob, t *testing.T) (*Cli, *bytes.Buffer, *[]string) {
+	cli, link, p := makeReturningCli(queue, t)
+	p.jobs = func() (pipeline.Jobs, error) {
+		return pipeline.Jobs{Jobs: jobs}, nil
+	}
+	deleted := []string{}
+	mutex := &sync.Mutex{}
+	p.delete = func(id string) (bool, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		deleted = append(deleted, id)
+		return true, nil
+	}
+	AddCleanCommand(cli, link)
+	buf := new(bytes.Buffer)
+	cli.Output = buf
+	return cli, buf, &deleted
+}
+
+func TestCleanFilters(t *testing.T) {
+	jobs := []pipeline.Job{JOB_1, JOB_2, JOB_3, {Id: "job4", Status: "FAIL", Nicename: "failed job"}}
+	cli, _, deleted := makeCleanCli(jobs, nil, t)
+	if err := cli.Run([]string{"clean", "--status", "fail,running", "--nicename", "*ed job"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	sort.Strings(*deleted)
+	if strings.Join(*deleted, ",") != "job4" {
+		t.Errorf("Wrong jobs removed %v", *deleted)
+	}
+}
+
+func TestCleanDryRun(t *testing.T) {
+	cli, buf, deleted := makeCleanCli([]pipeline.Job{JOB_2, JOB_3}, nil, t)
+	if err := cli.Run([]string{"clean", "-d", "--dry-run"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(*deleted) != 0 {
+		t.Errorf("Jobs removed in a dry run %v", *deleted)
+	}
+	if !strings.Contains(buf.String(), "Job job2 would be removed") || !strings.Contains(buf.String(), "Job job3 would be removed") {
+		t.Errorf("Wrong dry run output\n%v", buf.String())
+	}
+}
+
+//The webservice doesn't give the time of the jobs out of the queue
+func TestCleanTimesNeedQueuedJobs(t *testing.T) {
+	jobs := []pipeline.Job{{Id: "job1", Status: "ERROR"}, {Id: "job2", Status: "IDLE"}}
+	for _, args := range [][]string{
+		{"clean", "--since", "1h"},
+		{"clean", "--status", "idle,error", "--since", "1h"},
+		{"clean", "--status", "idle", "--done", "--until", "1h"},
+	} {
+		cli, _, deleted := makeCleanCli(jobs, nil, t)
+		err := cli.Run(args)
+		if ExitCode(err) != EXIT_USAGE || !strings.Contains(err.Error(), "--status IDLE") {
+			t.Errorf("Expected a usage error for %v, got %v", args, err)
+		}
+		if len(*deleted) != 0 {
+			t.Errorf("Jobs removed for %v: %v", args, *deleted)
+		}
+	}
+}
+
+func TestCleanConfirmation(t *testing.T) {
+	jobs := []pipeline.Job{}
+	for i := 0; i <= CLEAN_CONFIRM_ABOVE; i++ {
+		jobs = append(jobs, pipeline.Job{Id: fmt.Sprintf("job%v", i), Status: "ERROR"})
+	}
+	cli, buf, deleted := makeCleanCli(jobs, nil, t)
+	cli.Input = strings.NewReader("y\n")
+	if err := cli.Run([]string{"clean"}); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Errorf("Expected error when the input is not a terminal, got %v", err)
+	}
+	if len(*deleted) != 0 || buf.Len() != 0 {
+		t.Errorf("Jobs removed without confirmation %v\n%v", *deleted, buf.String())
+	}
+	var prompt bytes.Buffer
+	old := promptOutput
+	promptOutput = func(io.Reader) io.Writer { return &prompt }
+	defer func() { promptOutput = old }()
+	cli, buf, deleted = makeCleanCli(jobs, nil, t)
+	cli.Input = strings.NewReader("n\n")
+	if err := cli.Run([]string{"clean"}); err == nil {
+		t.Errorf("Expected error when the confirmation is refused")
+	}
+	if len(*deleted) != 0 || !strings.Contains(prompt.String(), "continue?") || strings.Contains(buf.String(), "continue?") {
+		t.Errorf("Jobs removed without confirmation %v\n%v", *deleted, prompt.String())
+	}
+	cli, _, deleted = makeCleanCli(jobs, nil, t)
+	cli.Input = strings.NewReader("y\n")
+	if err := cli.Run([]string{"clean"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(*deleted) != len(jobs) {
+		t.Errorf("Wrong number of jobs removed %v", len(*deleted))
+	}
+	cli, _, deleted = makeCleanCli(jobs, nil, t)
+	cli.Input = strings.NewReader("")
+	if err := cli.Run([]string{"clean", "-y"}); err != nil || len(*deleted) != len(jobs) {
+		t.Errorf("--yes didn't skip the confirmation %v %v", err, len(*deleted))
+	}
+}
+
+//Checks that wait follows the job until it's finished
+func TestWaitCommand(t *testing.T) {
+	cli, link, p := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddWaitCommand(cli, link)
+	err := cli.Run([]string{"wait", "job1"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if p.count < 2 {
+		t.Errorf("The job wasn't polled until it finished")
+	}
+	expected := "Job job1 finished with status SUCCESS\n"
+	result := string(r.Bytes())
+	if expected != result {
+		t.Errorf("The message is not correct '%s'!='%s'", expected, result)
+	}
+}
+
+//Checks that wait needs at least one id
+func TestWaitCommandNoId(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	AddWaitCommand(cli, link)
+	err := cli.Run([]string{"wait"})
+	if err == nil {
+		t.Errorf("Expected error not thrown")
+	}
+}
+
+//Checks that the timeout exit code is returned when the job takes too long
+func TestWaitCommandTimeout(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddWaitCommand(cli, link)
+	err := cli.Run([]string{"wait", "-t", "1ms", "job1", "job2"})
+	if ExitCode(err) != EXIT_TIMEOUT {
+		t.Errorf("Expected timeout exit code, got %v (%v)", ExitCode(err), err)
+	}
+	if !strings.Contains(r.String(), "Job job1 did not finish in time") {
+		t.Errorf("The timed out job is not reported '%s'", r.String())
+	}
+}
+
+//Checks that link errors are propagated
+func TestWaitCommandError(t *testing.T) {
+	cli, link, p := makeReturningCli(nil, t)
+	p.failOnCall = JOB_CALL
+	AddWaitCommand(cli, link)
+	err := cli.Run([]string{"wait", "job1"})
+	if err == nil {
+		t.Errorf("Expected error not propagated")
+	}
+	if ExitCode(err) != EXIT_FAILURE {
+		t.Errorf("Unknown link errors should exit with EXIT_FAILURE %v", ExitCode(err))
+	}
+}
+
+//Checks that the worst outcome defines the exit code
+func TestWaitExitError(t *testing.T) {
+	results := []waitResult{
+		{Id: "1", Status: "SUCCESS", Finished: true},
+		{Id: "2", Status: "FAIL", Finished: true},
+	}
+	if code := ExitCode(waitExitError(results)); code != EXIT_JOB_FAIL {
+		t.Errorf("Expected FAIL exit code got %v", code)
+	}
+	results = append(results, waitResult{Id: "3", Status: "ERROR", Finished: true})
+	if code := ExitCode(waitExitError(results)); code != EXIT_JOB_ERROR {
+		t.Errorf("Expected ERROR exit code got %v", code)
+	}
+	results = append(results, waitResult{Id: "4", Status: "RUNNING", Finished: false})
+	if code := ExitCode(waitExitError(results)); code != EXIT_TIMEOUT {
+		t.Errorf("Expected timeout exit code got %v", code)
+	}
+	if err := waitExitError(results[:1]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestJobsFilters(t *testing.T) {
+	jobs := pipeline.Jobs{Jobs: []pipeline.Job{JOB_1, JOB_2, JOB_3}}
+	cli, link, p := makeReturningCli(jobs, t)
+	p.jobs = func() (pipeline.Jobs, error) {
+		return jobs, nil
+	}
+	AddJobsCommand(cli, link)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err := cli.Run([]string{"jobs", "--status", "success,error", "--sort", "-id", "--limit", "1"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !strings.Contains(buf.String(), JOB_3.Id) || strings.Contains(buf.String(), JOB_2.Id) || strings.Contains(buf.String(), JOB_1.Id) {
+		t.Errorf("Wrong jobs listed\n%v", buf.String())
+	}
+	//the flags are set once per process
+	cli, link, p = makeReturningCli(jobs, t)
+	p.jobs = func() (pipeline.Jobs, error) {
+		return jobs, nil
+	}
+	AddJobsCommand(cli, link)
+	buf.Reset()
+	cli.Output = &buf
+	if err := cli.Run([]string{"jobs", "--nicename", "*_job"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !strings.Contains(buf.String(), JOB_1.Id) || !strings.Contains(buf.String(), JOB_2.Id) || strings.Contains(buf.String(), JOB_3.Id) {
+		t.Errorf("Wrong jobs listed\n%v", buf.String())
+	}
+	if err := cli.Run([]string{"jobs", "--status", "DONE"}); err == nil {
+		t.Errorf("Expected error for an invalid status")
+	}
+}
+
+func TestJobsSince(t *testing.T) {
+	idle1, idle2 := JOB_1, JOB_2
+	idle1.Status, idle2.Status = "IDLE", "IDLE"
+	jobs := pipeline.Jobs{Jobs: []pipeline.Job{idle1, idle2, JOB_3}}
+	now := time.Now()
+	queue := []pipeline.QueueJob{
+		{Id: JOB_1.Id, TimeStamp: now.Add(-3*time.Hour).UnixNano() / int64(time.Millisecond)},
+		{Id: JOB_2.Id, TimeStamp: now.Add(-time.Minute).UnixNano() / int64(time.Millisecond)},
+	}
+	run := func(args ...string) (string, PipelineLink, error) {
+		cli, link, p := makeReturningCli(queue, t)
+		p.jobs = func() (pipeline.Jobs, error) {
+			return jobs, nil
+		}
+		AddJobsCommand(cli, link)
+		var buf bytes.Buffer
+		cli.Output = &buf
+		err := cli.Run(append([]string{"jobs"}, args...))
+		return buf.String(), link, err
+	}
+	for _, args := range [][]string{{"--since", "1h"}, {"--sort", "-time"}, {"--status", "idle,error", "--until", "1h"}} {
+		if _, _, err := run(args...); ExitCode(err) != EXIT_USAGE || !strings.Contains(err.Error(), "--status IDLE") {
+			t.Errorf("Expected a usage error for %v, got %v", args, err)
+		}
+	}
+	out, link, err := run("--status", "idle", "--since", "1h")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if getCall(link) != QUEUE_CALL {
+		t.Errorf("The job times weren't requested")
+	}
+	if !strings.Contains(out, JOB_2.Id) || strings.Contains(out, JOB_1.Id) || strings.Contains(out, JOB_3.Id) {
+		t.Errorf("Wrong jobs listed\n%v", out)
+	}
+	out, _, err = run("--status", "idle", "--sort", "-time")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if first, second := strings.Index(out, JOB_2.Id), strings.Index(out, JOB_1.Id); first < 0 || second < first {
+		t.Errorf("Wrong order\n%v", out)
+	}
+}
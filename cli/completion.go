@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"text/template"
+
+	"github.com/capitancambio/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//The completion scripts call "PROG __complete ARGS... WORD", which prints a
+//candidate per line followed by :KIND, where KIND tells whether the shell has
+//to complete file (1) or directory (2) names instead
+const (
+	BashCompletionTemplate = `# bash completion for {{.Name}}, load it with: source <({{.Name}} completion bash)
+_{{.Func}}_complete() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local IFS=$'\n'
+    local out=($({{.Name}} __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null))
+    local kind=""
+    if [ ${#out[@]} -gt 0 ]; then
+        kind="${out[${#out[@]}-1]}"
+        unset 'out[${#out[@]}-1]'
+    fi
+    case "$kind" in
+        :1) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        :2) COMPREPLY=($(compgen -d -- "$cur")) ;;
+        *) COMPREPLY=("${out[@]}") ;;
+    esac
+}
+complete -o filenames -F _{{.Func}}_complete {{.Name}}
+`
+	ZshCompletionTemplate = `#compdef {{.Name}}
+# zsh completion for {{.Name}}, load it with: source <({{.Name}} completion zsh)
+_{{.Func}}() {
+    local -a out
+    out=("${(@f)$({{.Name}} __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+    local kind=${out[-1]}
+    out=("${(@)out[1,-2]}")
+    case $kind in
+        :1) _files ;;
+        :2) _files -/ ;;
+        *) compadd -- "${out[@]}" ;;
+    esac
+}
+compdef _{{.Func}} {{.Name}}
+`
+	FishCompletionTemplate = `# fish completion for {{.Name}}, load it with: {{.Name}} completion fish | source
+function __{{.Func}}_complete
+    set -l tokens (commandline -opc)
+    set -l cur (commandline -ct)
+    set -l out ({{.Name}} __complete $tokens[2..-1] "$cur" 2>/dev/null)
+    set -l kind ""
+    if test (count $out) -gt 0
+        set kind $out[-1]
+        set -e out[-1]
+    end
+    switch $kind
+        case :1
+            __fish_complete_path "$cur"
+        case :2
+            __fish_complete_directories "$cur"
+        case '*'
+            printf '%s\n' $out
+    end
+end
+complete -c {{.Name}} -f -a '(__{{.Func}}_complete)'
+`
+)
+
+var completionTemplates = map[string]string{
+	"bash": BashCompletionTemplate,
+	"zsh":  ZshCompletionTemplate,
+	"fish": FishCompletionTemplate,
+}
+
+var nonIdentifierRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+//Adds the completion command, that prints the completion script for the given
+//shell, and the hidden __complete command used by those scripts
+func AddCompletionCommand(cli *Cli, link *PipelineLink) {
+	cmd := cli.AddCommand("completion", "Prints the completion script for the given shell (bash, zsh or fish)", func(command string, args ...string) error {
+		tmpl, ok := completionTemplates[args[0]]
+		if !ok {
+			return fmt.Errorf("%v is not a supported shell. Supported shells are bash, zsh and fish", args[0])
+		}
+		name := cli.Parser.Name
+		return template.Must(template.New("completion").Parse(tmpl)).Execute(cli.Output, struct{ Name, Func string }{name, nonIdentifierRe.ReplaceAllString(name, "_")})
+	})
+	cmd.SetArity(1, "SHELL")
+	cli.offline[cmd.Name] = true
+	cli.OnComplete(func(command string, args ...string) error {
+		cli.addCompletionScripts(link)
+		candidates, kind := cli.Complete(args)
+		for _, candidate := range candidates {
+			fmt.Fprintln(cli.Output, candidate)
+		}
+		fmt.Fprintf(cli.Output, ":%d\n", kind)
+		return nil
+	})
+}
+
+//Adds the script commands from the cached script list, completion doesn't wait
+//for the webservice to list the scripts. The webservice is only contacted when
+//the flags of a script are completed, and it's never started. No scripts are
+//added if there is no cache for the configured webservice yet
+func (c *Cli) addCompletionScripts(link *PipelineLink) {
+	if err := c.applyProfile(link.config); err != nil {
+		return
+	}
+	if err := c.applyEnv(link.config); err != nil {
+		return
+	}
+	cache, err := loadScriptCache(ScriptCachePath)
+	if err != nil || cache.Url != link.config.Url() {
+		log.Println("No script list cache to complete the scripts")
+		return
+	}
+	link.config[STARTING] = false
+	if err := c.AddLazyScripts(cache.Scripts, link); err != nil {
+		return
+	}
+	for _, cmd := range c.Scripts {
+		cmd := cmd
+		if cmd.loader == nil {
+			continue
+		}
+		loader := cmd.loader
+		cmd.loader = func() error {
+			if err := link.Init(); err != nil {
+				return err
+			}
+			if err := loader(); err != nil {
+				return err
+			}
+			if !link.IsLocal() {
+				cmd.addDataOption()
+			}
+			return nil
+		}
+	}
+}
+
+//Returns the values offered by the shell completion for the option type
+func optionCompletion(optionType pipeline.DataType) subcommand.Completion {
+	switch t := optionType.(type) {
+	case pipeline.AnyFileURI:
+		return subcommand.Completion{Kind: subcommand.CompleteFiles}
+	case pipeline.AnyDirURI:
+		return subcommand.Completion{Kind: subcommand.CompleteDirs}
+	case pipeline.XsBoolean:
+		return subcommand.Completion{Values: []string{"true", "false"}}
+	case pipeline.Value:
+		return subcommand.Completion{Values: []string{t.Value}}
+	case pipeline.Choice:
+		completion := subcommand.Completion{}
+		for _, value := range t.Values {
+			choice := optionCompletion(value)
+			completion.Values = append(completion.Values, choice.Values...)
+			if choice.Kind != subcommand.CompleteValues {
+				completion.Kind = choice.Kind
+			}
+		}
+		return completion
+	}
+	return subcommand.Completion{}
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func makeCompletionCli(t *testing.T) (*Cli, *bytes.Buffer) {
+	config := copyConf()
+	config[STARTING] = false
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: config}
+	cli, err := makeCli("dp2", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddCompletionCommand(cli, link)
+	summary := pipeline.Script{Id: SCRIPT.Id, Href: SCRIPT.Href, Description: SCRIPT.Description}
+	if err := storeScriptCache(ScriptCachePath, scriptCache{config.Url(), "version-test", []pipeline.Script{summary}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	buf := new(bytes.Buffer)
+	cli.Output = buf
+	return cli, buf
+}
+
+func TestComplete(t *testing.T) {
+	defer withScriptCache()()
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"te"}, "test\n:0\n"},
+		{[]string{"help", "comp"}, "completion\n:0\n"},
+		{[]string{"--form"}, "--format\n:0\n"},
+		{[]string{"--format", "j"}, "json\n:0\n"},
+		{[]string{"test", "--another-opt", ""}, "foo\nbar\n:0\n"},
+		{[]string{"test", "--source", "./tmp/file", "--pri"}, "--priority\n:0\n"},
+		{[]string{"test", "--source", ""}, ":1\n"},
+		{[]string{"test", "-o", ""}, ":2\n"},
+	}
+	for _, test := range tests {
+		cli, buf := makeCompletionCli(t)
+		if err := cli.Run(append([]string{"__complete"}, test.args...)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if buf.String() != test.out {
+			t.Errorf("Wrong candidates for %v: %q", test.args, buf.String())
+		}
+	}
+}
+
+func TestCompleteNoCache(t *testing.T) {
+	defer withScriptCache()()
+	config := copyConf()
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: config}
+	cli, err := makeCli("dp2", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddCompletionCommand(cli, link)
+	buf := new(bytes.Buffer)
+	cli.Output = buf
+	if err := cli.Run([]string{"__complete", "te"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.String() != ":0\n" {
+		t.Errorf("Scripts completed without cache %q", buf.String())
+	}
+	if getCall(*link) != "" {
+		t.Errorf("The webservice was called")
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	defer withScriptCache()()
+	cli, buf := makeCompletionCli(t)
+	if err := cli.Run([]string{"completion", "bash"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !strings.Contains(buf.String(), "complete -o filenames -F _dp2_complete dp2") {
+		t.Errorf("Wrong bash completion script\n%v", buf.String())
+	}
+	if err := cli.Run([]string{"completion", "powershell"}); err == nil {
+		t.Errorf("Expected error for unsupported shell")
+	}
+}
@@ -1,12 +1,18 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/kardianos/osext"
 	"launchpad.net/goyaml"
@@ -22,14 +28,29 @@ const (
 	CLIENTKEY    = "client_key"
 	CLIENTSECRET = "client_secret"
 	TIMEOUT      = "timeout"
+	RETRIES      = "retries"
+	RETRYDELAY   = "retry_delay"
+	MAXDATA      = "max_data"
 	DEBUG        = "debug"
 	STARTING     = "starting"
+	PROFILES     = "profiles"
 )
 
 //Other convinience constants
 const (
 	ERR_STR      = "Error parsing configuration: %v"
 	DEFAULT_FILE = "config.yml"
+	PROFILE_ENV  = "DP2_PROFILE" //environment variable to select the profile
+	ENV_PREFIX   = "DP2_"        //prefix of the environment variables overriding the configuration
+)
+
+//Kinds of origins of the configuration values
+const (
+	ORIGIN_DEFAULT = "default"
+	ORIGIN_FILE    = "file"
+	ORIGIN_PROFILE = "profile"
+	ORIGIN_ENV     = "env"
+	ORIGIN_FLAG    = "flag"
 )
 
 //Config is just a map
@@ -46,10 +67,29 @@ var config = Config{
 	CLIENTKEY:    "",
 	CLIENTSECRET: "",
 	TIMEOUT:      10,
+	RETRIES:      3,
+	RETRYDELAY:   500,
+	MAXDATA:      100,
 	DEBUG:        false,
 	STARTING:     false,
 }
 
+//Where a configuration value comes from
+type configOrigin struct {
+	Kind   string //default, file, profile, env or flag
+	Detail string //file path, profile name, variable or flag name
+}
+
+func (o configOrigin) String() string {
+	if o.Detail == "" {
+		return o.Kind
+	}
+	return o.Kind + " " + o.Detail
+}
+
+//Origins of the values read from the configuration files by NewConfig
+var fileOrigins = map[string]configOrigin{}
+
 //Config items descriptions
 var config_descriptions = map[string]string{
 
@@ -60,7 +100,10 @@ var config_descriptions = map[string]string{
 	EXECLINE:     "Pipeline webserivice executable path",
 	CLIENTKEY:    "Client key for authenticated requests",
 	CLIENTSECRET: "Client secrect for authenticated requests",
-	TIMEOUT:      "Http connection timeout in seconds",
+	TIMEOUT:      "Seconds without an answer from the webservice after which a request is given up",
+	RETRIES:      "Times a request is retried when the webservice can't be reached",
+	RETRYDELAY:   "Milliseconds to wait before retrying a request, doubled on every retry",
+	MAXDATA:      "Maximum size in MB of the zip with the local files sent to remote webservices",
 	DEBUG:        "Print debug messages. true or false. ",
 	STARTING:     "Start the webservice in the local computer if it is not running. true or false",
 }
@@ -74,34 +117,107 @@ func copyConf() Config {
 	return ret
 }
 
-//Tries to load the default configuration file ( folder where the executable is located / config.yml) if not possible
-//returns a minimal configuration setup
+//Loads the configuration files found in configPaths, if none is found returns
+//a minimal configuration setup
 func NewConfig() Config {
 	cnf := copyConf()
-	if err := loadDefault(cnf); err != nil {
-		fmt.Println("Warning : no default configuration file found")
-		log.Println(err.Error())
+	if loaded := loadDefault(cnf); loaded == 0 {
+		//on stderr so that it doesn't get mixed with the output (completion, json...)
+		fmt.Fprintln(os.Stderr, "Warning : no default configuration file found")
 		return copyConf()
 	}
 	return cnf
 }
 
-//Loads the default configuration file
-func loadDefault(cnf Config) error {
-	folder, err := osext.ExecutableFolder()
-	if err != nil {
-		return err
+//Returns the paths where the configuration files are looked for, sorted by
+//precedence: the user files and then the one in the folder where the
+//executable is located
+func configPaths() []string {
+	paths := userConfigPaths()
+	if folder, err := osext.ExecutableFolder(); err == nil {
+		paths = append(paths, filepath.Join(folder, DEFAULT_FILE))
 	}
-	file, err := os.Open(folder + string(os.PathSeparator) + DEFAULT_FILE)
-	if err != nil {
-		return err
+	return paths
+}
+
+//Returns the paths of the user configuration files sorted by precedence:
+//$XDG_CONFIG_HOME/daisy-pipeline/dp2/config.yml and the one in the folder
+//of the last id file
+func userConfigPaths() []string {
+	paths := []string{}
+	if xdg := xdgConfigPath(); xdg != "" {
+		paths = append(paths, xdg)
+	}
+	return append(paths, filepath.Join(filepath.Dir(LastIdPath), DEFAULT_FILE))
+}
+
+//Returns the path of the configuration file following the XDG base directory
+//specification. $XDG_CONFIG_HOME defaults to ~/.config in linux, in the other
+//platforms the path is empty unless the variable is set
+func xdgConfigPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" && runtime.GOOS == "linux" {
+		base = filepath.Join(homePath(), ".config")
 	}
-	defer file.Close()
-	err = cnf.FromYaml(file)
+	if base == "" {
+		return ""
+	}
+	return filepath.Join(base, "daisy-pipeline", "dp2", DEFAULT_FILE)
+}
+
+//Returns the configuration file edited by config set and unset: the first of
+//the user files that exists, or the preferred one if there is none yet
+func userConfigPath() string {
+	paths := userConfigPaths()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return paths[0]
+}
+
+//Loads the configuration files that exist, the ones with lower precedence
+//first. Returns the number of files loaded
+func loadDefault(cnf Config) (loaded int) {
+	paths := configPaths()
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		keys, err := cnf.fromYamlFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Warning : error loading %v: %v\n", path, err)
+			}
+			log.Println(err.Error())
+			continue
+		}
+		for _, key := range keys {
+			fileOrigins[key] = configOrigin{ORIGIN_FILE, path}
+		}
+		loaded++
+	}
+	return
+}
+
+//Loads the yaml file into the configuration and returns the keys defined in it
+func (c Config) fromYamlFile(path string) (keys []string, err error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return err
+		return
 	}
-	return nil
+	values := make(Config)
+	if err = goyaml.Unmarshal(data, values); err != nil {
+		return
+	}
+	if err = c.FromYaml(bytes.NewReader(data)); err != nil {
+		return
+	}
+	for key := range values {
+		if key != PROFILES {
+			keys = append(keys, key)
+		}
+	}
+	return
 }
 
 //Loads the contents of the yaml file into the configuration
@@ -110,14 +226,114 @@ func (c Config) FromYaml(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	profiles := c.Profiles()
 	err = goyaml.Unmarshal(bytes, c)
 	if err != nil {
 		return err
 	}
+	//keep the profiles already loaded unless they are redefined
+	for name, profile := range c.Profiles() {
+		profiles[name] = profile
+	}
+	if len(profiles) > 0 {
+		c[PROFILES] = profiles
+	}
 	c.UpdateDebug()
 	return err
 }
 
+//Returns the named connection profiles defined under the profiles key
+func (c Config) Profiles() map[string]Config {
+	profiles := make(map[string]Config)
+	switch raw := c[PROFILES].(type) {
+	case map[string]Config:
+		for name, profile := range raw {
+			profiles[name] = profile
+		}
+	case map[interface{}]interface{}:
+		for name, values := range raw {
+			profile := make(Config)
+			if values, ok := values.(map[interface{}]interface{}); ok {
+				for key, value := range values {
+					profile[fmt.Sprint(key)] = value
+				}
+			}
+			profiles[fmt.Sprint(name)] = profile
+		}
+	}
+	return profiles
+}
+
+//Returns the profile with the given name
+func (c Config) Profile(name string) (Config, error) {
+	profiles := c.Profiles()
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %v not found (available profiles: %v)", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+//Sets the value of the configuration key from its string representation, which
+//is converted to the type of the default value
+func (c Config) SetString(key, value string) error {
+	if _, ok := config[key]; !ok {
+		return fmt.Errorf("unknown configuration key %v", key)
+	}
+	switch config[key].(type) {
+	case int:
+		val, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("option %v must be a numeric value (found %v)", key, value)
+		}
+		c[key] = val
+	case bool:
+		switch {
+		case value == "true":
+			c[key] = true
+		case value == "false":
+			c[key] = false
+		default:
+			return fmt.Errorf("option %v must be true or false (found %v)", key, value)
+		}
+
+	case string:
+		c[key] = value
+
+	}
+	return nil
+}
+
+//Returns the name of the environment variable that overrides the configuration key
+func envName(key string) string {
+	return ENV_PREFIX + strings.ToUpper(key)
+}
+
+//Checks that the value can be assigned to the configuration key, i.e. the key
+//exists and the value has the same type as its default
+func checkConfigValue(key string, value interface{}) error {
+	def, ok := config[key]
+	if !ok {
+		return fmt.Errorf("unknown configuration key %v", key)
+	}
+	if reflect.TypeOf(def) != reflect.TypeOf(value) {
+		switch def.(type) {
+		case int:
+			return fmt.Errorf("option %v must be a numeric value (found %v)", key, value)
+		case bool:
+			return fmt.Errorf("option %v must be true or false (found %v)", key, value)
+		default:
+			return fmt.Errorf("option %v must be a string (found %v)", key, value)
+		}
+	}
+	return nil
+}
+
 //This method should be called if the DEBUG configuration is changed. The internal Config methods
 //do this automatically
 func (c Config) UpdateDebug() {
@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"launchpad.net/goyaml"
+)
+
+const (
+	ConfigProfilesTemplate = `{{range .}}{{if .Active}}*{{else}} {{end}} {{.Name}}	{{.Url}}
+{{end}}`
+
+	ConfigShowTemplate = `{{range .}}{{.Key}}	{{.Value}}	({{.Origin}})
+{{end}}`
+
+	ConfigValueTemplate = `{{.Value}}
+`
+
+	SECRET_MASK = "********" //Replaces the secrets in config show
+)
+
+//Configuration keys whose values are not shown
+var secretKeys = map[string]bool{
+	CLIENTSECRET: true,
+}
+
+//Configuration value as listed by config show
+type configEntry struct {
+	Key    string
+	Value  interface{}
+	Origin string
+}
+
+//Profile as listed by config profiles
+type profileEntry struct {
+	Name   string
+	Url    string
+	Active bool
+}
+
+//Action of the config command
+type configAction struct {
+	arity    int    //number of parameters
+	usage    string //parameters description
+	template string //output template
+	fn       call
+}
+
+//Returns the name of the selected profile, given either by the --profile
+//option or the DP2_PROFILE environment variable
+func (c Cli) selectedProfile() string {
+	if c.profile != "" {
+		return c.profile
+	}
+	return os.Getenv(PROFILE_ENV)
+}
+
+//Overlays the selected profile on the configuration. The values given through
+//global flags take precedence over the profile ones
+func (c *Cli) applyProfile(conf Config) error {
+	name := c.selectedProfile()
+	if name == "" {
+		return nil
+	}
+	profile, err := conf.Profile(name)
+	if err != nil {
+		return err
+	}
+	c.unprofiled = make(Config)
+	for key, value := range conf {
+		c.unprofiled[key] = value
+	}
+	for key, value := range profile {
+		if err := checkConfigValue(key, value); err != nil {
+			return fmt.Errorf("profile %v: %v", name, err)
+		}
+		if c.origins[key].Kind == ORIGIN_FLAG {
+			continue
+		}
+		conf[key] = value
+		c.origins[key] = configOrigin{ORIGIN_PROFILE, name}
+	}
+	conf.UpdateDebug()
+	return nil
+}
+
+//Overrides the configuration with the DP2_* environment variables (DP2_HOST,
+//DP2_CLIENT_KEY...). The values given through global flags take precedence
+//over the environment ones
+func (c *Cli) applyEnv(conf Config) error {
+	changed := false
+	for _, key := range configKeys() {
+		name := envName(key)
+		value := os.Getenv(name)
+		if value == "" || c.origins[key].Kind == ORIGIN_FLAG {
+			continue
+		}
+		if err := conf.SetString(key, value); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		c.origins[key] = configOrigin{ORIGIN_ENV, name}
+		changed = true
+	}
+	if changed {
+		conf.UpdateDebug()
+	}
+	return nil
+}
+
+//Returns the configuration keys sorted by name
+func configKeys() []string {
+	keys := make([]string, 0, len(config_descriptions))
+	for key := range config_descriptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Lists the effective configuration and where every value comes from
+func (c Cli) showConfig(conf Config) []configEntry {
+	entries := []configEntry{}
+	for _, key := range configKeys() {
+		value := conf[key]
+		if secretKeys[key] && value != "" {
+			value = SECRET_MASK
+		}
+		origin, ok := c.origins[key]
+		if !ok {
+			origin = configOrigin{Kind: ORIGIN_DEFAULT}
+		}
+		entries = append(entries, configEntry{Key: key, Value: value, Origin: origin.String()})
+	}
+	return entries
+}
+
+//Returns the effective value of the configuration key
+func (c Cli) configValue(conf Config, key string) (entry configEntry, err error) {
+	if _, ok := config[key]; !ok {
+		return entry, fmt.Errorf("unknown configuration key %v", key)
+	}
+	origin, ok := c.origins[key]
+	if !ok {
+		origin = configOrigin{Kind: ORIGIN_DEFAULT}
+	}
+	return configEntry{Key: key, Value: conf[key], Origin: origin.String()}, nil
+}
+
+//Sets the value of the key in the user configuration file, checking that it
+//suits the type of the default value
+func setUserConfig(key, value string) (string, error) {
+	typed := copyConf()
+	if err := typed.SetString(key, value); err != nil {
+		return "", err
+	}
+	path := userConfigPath()
+	if _, err := editUserConfig(path, key, typed[key]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v set in %v\n", key, path), nil
+}
+
+//Removes the key from the user configuration file
+func unsetUserConfig(key string) (string, error) {
+	if _, ok := config[key]; !ok {
+		return "", fmt.Errorf("unknown configuration key %v", key)
+	}
+	path := userConfigPath()
+	found, err := editUserConfig(path, key, nil)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return fmt.Sprintf("%v is not set in %v\n", key, path), nil
+	}
+	return fmt.Sprintf("%v removed from %v\n", key, path), nil
+}
+
+//Sets the top level key of the user configuration file (if it exists) to the
+//value, or removes it if the value is nil. Only the lines of the key are
+//changed, so that the comments and the order of the rest of the file are kept.
+//Returns whether the key was in the file
+func editUserConfig(path, key string, value interface{}) (found bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err = goyaml.Unmarshal(data, make(map[string]interface{})); err != nil {
+		return false, fmt.Errorf("Error parsing %v: %v", path, err)
+	}
+	entry := ""
+	if value != nil {
+		out, err := goyaml.Marshal(map[string]interface{}{key: value})
+		if err != nil {
+			return false, err
+		}
+		entry = strings.TrimSuffix(string(out), "\n")
+	}
+	keyLine := regexp.MustCompile(`^` + regexp.QuoteMeta(key) + `\s*:`)
+	lines := []string{}
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	edited := []string{}
+	for idx := 0; idx < len(lines); idx++ {
+		if !keyLine.MatchString(lines[idx]) {
+			edited = append(edited, lines[idx])
+			continue
+		}
+		//the value may go on in the indented lines that follow
+		for idx+1 < len(lines) && strings.TrimSpace(lines[idx+1]) != "" && strings.TrimLeft(lines[idx+1], " \t") != lines[idx+1] {
+			idx++
+		}
+		if !found && entry != "" {
+			edited = append(edited, entry)
+		}
+		found = true
+	}
+	if !found && entry != "" {
+		edited = append(edited, entry)
+	}
+	if err = mkdir(filepath.Dir(path)); err != nil {
+		return false, err
+	}
+	data = []byte(strings.Join(edited, "\n") + "\n")
+	if err = goyaml.Unmarshal(data, make(map[string]interface{})); err != nil {
+		return false, fmt.Errorf("Error editing %v, it's been left as it was: %v", path, err)
+	}
+	return found, ioutil.WriteFile(path, data, 0644)
+}
+
+//Lists the profiles sorted by name, marking the selected one. The profiles are
+//overlaid on the configuration as it was before applying the selected one
+func (c Cli) listProfiles(conf Config) []profileEntry {
+	active := c.selectedProfile()
+	if c.unprofiled != nil {
+		conf = c.unprofiled
+	}
+	entries := []profileEntry{}
+	for name, profile := range conf.Profiles() {
+		merged := make(Config)
+		for key, value := range conf {
+			merged[key] = value
+		}
+		for key, value := range profile {
+			merged[key] = value
+		}
+		entries = append(entries, profileEntry{Name: name, Url: merged.Url(), Active: name == active})
+	}
+	sort.Sort(profilesByName(entries))
+	return entries
+}
+
+type profilesByName []profileEntry
+
+func (p profilesByName) Len() int           { return len(p) }
+func (p profilesByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p profilesByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+//Adds the config command. It only deals with the configuration so it doesn't
+//connect to the webservice. set and unset edit the user configuration file
+func AddConfigCommand(cli *Cli, link PipelineLink) {
+	actions := map[string]configAction{
+		"profiles": configAction{0, "", ConfigProfilesTemplate, func(...string) (interface{}, error) {
+			return cli.listProfiles(link.config), nil
+		}},
+		"show": configAction{0, "", ConfigShowTemplate, func(...string) (interface{}, error) {
+			return cli.showConfig(link.config), nil
+		}},
+		"get": configAction{1, "KEY", ConfigValueTemplate, func(args ...string) (interface{}, error) {
+			return cli.configValue(link.config, args[0])
+		}},
+		"set": configAction{2, "KEY VALUE", SimpleTemplate, func(args ...string) (interface{}, error) {
+			return setUserConfig(args[0], args[1])
+		}},
+		"unset": configAction{1, "KEY", SimpleTemplate, func(args ...string) (interface{}, error) {
+			return unsetUserConfig(args[0])
+		}},
+	}
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cmd := cli.AddCommand("config", "Shows and edits the configuration: "+strings.Join(names, ", "), func(command string, args ...string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("%v: no action given (%v)", command, strings.Join(names, ", "))
+		}
+		action, ok := actions[args[0]]
+		if !ok {
+			return fmt.Errorf("%v: unknown action %v (%v)", command, args[0], strings.Join(names, ", "))
+		}
+		if len(args)-1 != action.arity {
+			return UsageError{fmt.Errorf("Usage: %v %v %v", command, args[0], action.usage)}
+		}
+		data, err := action.fn(args[1:]...)
+		if err != nil {
+			return err
+		}
+		return commandBuilder{template: action.template}.writeOutput(data, cli)
+	})
+	cmd.SetArity(-1, "ACTION")
+	cli.offline[cmd.Name] = true
+}
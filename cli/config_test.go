@@ -3,6 +3,7 @@ package cli
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -169,3 +170,145 @@ func TestBuildPath(t *testing.T) {
 	}
 
 }
+
+var PROFILES_YAML = `
+host: http://localhost
+port: 8181
+profiles:
+  staging:
+    host: http://staging.daisy.org
+    port: 9000
+  production:
+    host: http://daisy.org
+    client_key: prodkey
+`
+
+func TestConfigProfiles(t *testing.T) {
+	cnf := copyConf()
+	if err := cnf.FromYaml(bytes.NewBufferString(PROFILES_YAML)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	profiles := cnf.Profiles()
+	if len(profiles) != 2 {
+		t.Fatalf("Wrong number of profiles %v", profiles)
+	}
+	staging, err := cnf.Profile("staging")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if staging[HOST] != "http://staging.daisy.org" || staging[PORT] != 9000 {
+		t.Errorf("Wrong staging profile %v", staging)
+	}
+	if cnf[HOST] != "http://localhost" {
+		t.Errorf("The profiles changed the top level values")
+	}
+	if _, err := cnf.Profile("dev"); err == nil {
+		t.Errorf("Expected error for unknown profile")
+	}
+}
+
+func TestConfigProfilesMerge(t *testing.T) {
+	cnf := copyConf()
+	if err := cnf.FromYaml(bytes.NewBufferString(PROFILES_YAML)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	other := "profiles:\n  dev:\n    port: 8282\n  staging:\n    port: 9001\n"
+	if err := cnf.FromYaml(bytes.NewBufferString(other)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	profiles := cnf.Profiles()
+	if len(profiles) != 3 {
+		t.Errorf("Wrong number of profiles %v", profiles)
+	}
+	if profiles["staging"][PORT] != 9001 {
+		t.Errorf("The staging profile wasn't redefined %v", profiles["staging"])
+	}
+}
+
+func TestCheckConfigValue(t *testing.T) {
+	if err := checkConfigValue(PORT, 80); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := checkConfigValue(PORT, "eighty"); err == nil {
+		t.Errorf("Expected type error")
+	}
+	if err := checkConfigValue("colour", "blue"); err == nil {
+		t.Errorf("Expected unknown key error")
+	}
+}
+
+func TestConfigSetString(t *testing.T) {
+	cnf := copyConf()
+	if err := cnf.SetString(PORT, "9000"); err != nil || cnf[PORT] != 9000 {
+		t.Errorf("Wrong port %v (%v)", cnf[PORT], err)
+	}
+	if err := cnf.SetString(STARTING, "true"); err != nil || cnf[STARTING] != true {
+		t.Errorf("Wrong starting %v (%v)", cnf[STARTING], err)
+	}
+	if err := cnf.SetString(PORT, "ninethousand"); err == nil {
+		t.Errorf("Port: non numeric type controll failed")
+	}
+	if err := cnf.SetString(DEBUG, "yes"); err == nil {
+		t.Errorf("Debug: non boolean type controll failed")
+	}
+}
+
+//Points the user configuration files to a temporary directory
+func withUserConfigDirs(t *testing.T) (xdg, lastId string, restore func()) {
+	base, err := ioutil.TempDir("", "dp2_config_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	oldLastId := LastIdPath
+	oldXdg := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(base, "xdg"))
+	LastIdPath = filepath.Join(base, "dp2", "lastid")
+	restore = func() {
+		LastIdPath = oldLastId
+		os.Setenv("XDG_CONFIG_HOME", oldXdg)
+		os.RemoveAll(base)
+	}
+	return filepath.Join(base, "xdg", "daisy-pipeline", "dp2", DEFAULT_FILE), filepath.Join(base, "dp2", DEFAULT_FILE), restore
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	xdg, lastId, restore := withUserConfigDirs(t)
+	defer restore()
+	paths := configPaths()
+	if len(paths) != 3 || paths[0] != xdg || paths[1] != lastId {
+		t.Errorf("Wrong configuration paths %v", paths)
+	}
+	if userConfigPath() != xdg {
+		t.Errorf("The xdg file should be the default user file (%v)", userConfigPath())
+	}
+	writeFile(t, lastId, "port: 8000\n")
+	if userConfigPath() != lastId {
+		t.Errorf("The existing user file should be edited (%v)", userConfigPath())
+	}
+}
+
+func TestNewConfigUserFiles(t *testing.T) {
+	xdg, lastId, restore := withUserConfigDirs(t)
+	defer restore()
+	writeFile(t, lastId, "host: http://daisy.org\nport: 8000\n")
+	writeFile(t, xdg, "port: 9000\n")
+	cnf := NewConfig()
+	if cnf[HOST] != "http://daisy.org" {
+		t.Errorf(T_STRING, HOST, "http://daisy.org", cnf[HOST])
+	}
+	if cnf[PORT] != 9000 {
+		t.Errorf(T_STRING, PORT, 9000, cnf[PORT])
+	}
+	if fileOrigins[PORT].Detail != xdg || fileOrigins[HOST].Detail != lastId {
+		t.Errorf("Wrong origins %v", fileOrigins)
+	}
+}
@@ -0,0 +1,550 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//Attributes whose values point to the resources of a document (images, css,
+//audio, other documents...), whatever their namespace
+var referenceAttributes = map[string]bool{"href": true, "src": true, "altimg": true, "longdesc": true, "data": true, "poster": true}
+
+//Extensions of the documents whose references are followed
+var documentExtensions = map[string]bool{".xml": true, ".xhtml": true, ".html": true, ".htm": true, ".opf": true, ".ncx": true, ".smil": true, ".svg": true}
+
+var (
+	cssUrlRe       = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+	cssImportRe    = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+	stylesheetPIRe = regexp.MustCompile(`href\s*=\s*['"]([^'"]+)['"]`)
+)
+
+//Local file or directory referenced by the job request, along with the path
+//it's given in the data zip
+type localPath struct {
+	path  string //absolute path in the file system
+	dir   bool
+	entry string //path relative to the zip root, directories end with /
+}
+
+//Packages the local files referenced by the inputs and file options of the
+//request into its data zip, and rewrites their values to the paths in the zip.
+//The zip is rooted at the deepest folder containing every packaged file. Along
+//with each file go the local resources it references (images, css...), and
+//the directories are included as a whole. Fails if the zip would take more
+//than maxSize bytes. If the data was given by the user it's checked instead
+func packageData(req *JobRequest, maxSize int64) error {
+	if req.Data != nil {
+		return checkDataZip(req)
+	}
+	paths := map[string]*localPath{}
+	for name, values := range req.Inputs {
+		for _, value := range values {
+			if err := addLocalPath(paths, value.Opaque); err != nil {
+				return fmt.Errorf("--%v: %v", name, err)
+			}
+		}
+	}
+	for name := range req.FileOptions {
+		for _, value := range req.Options[name] {
+			if err := addLocalPath(paths, value); err != nil {
+				return fmt.Errorf("--%v: %v", name, err)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	files, err := packagedFiles(paths)
+	if err != nil {
+		return err
+	}
+	root, err := commonRoot(paths)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if p.entry, err = zipEntryName(root, p.path); err != nil {
+			return err
+		}
+		if p.dir {
+			p.entry += "/"
+		}
+	}
+	data, entries, err := zipFiles(root, paths, files, maxSize)
+	if err != nil {
+		return err
+	}
+	//point the request to the zip
+	for name, values := range req.Inputs {
+		for idx, value := range values {
+			if p, ok := paths[value.Opaque]; ok {
+				req.Inputs[name][idx] = url.URL{Opaque: p.entry}
+			}
+		}
+	}
+	for name := range req.FileOptions {
+		for idx, value := range req.Options[name] {
+			if p, ok := paths[value]; ok {
+				req.Options[name][idx] = p.entry
+			}
+		}
+	}
+	if err := checkZipPaths(req, entries); err != nil {
+		return err
+	}
+	log.Printf("Packaged %v files from %v into the data zip (%v bytes)", len(entries), root, len(data))
+	req.Data = data
+	return nil
+}
+
+//Adds the path to the local paths if it's not a url. Fails if the path doesn't exist
+func addLocalPath(paths map[string]*localPath, value string) error {
+	if _, ok := paths[value]; ok || value == "" {
+		return nil
+	}
+	if isRemoteUri(value) {
+		return nil
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(value))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("%v not found", value)
+	}
+	paths[value] = &localPath{path: abs, dir: info.IsDir()}
+	return nil
+}
+
+//Returns true if the value is a url with a scheme (http:...) rather than a
+//local path, the webservice deals with those. One letter schemes are taken
+//as windows drives
+func isRemoteUri(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && len(u.Scheme) > 1
+}
+
+//Returns the directory itself or the folder of the file
+func (p localPath) folder() string {
+	if p.dir {
+		return p.path
+	}
+	return filepath.Dir(p.path)
+}
+
+//Returns the deepest folder containing the folders of every path. The files
+//they reference are inside them, so they don't widen it
+func commonRoot(paths map[string]*localPath) (string, error) {
+	root := ""
+	folders := []string{}
+	for _, p := range paths {
+		folders = append(folders, p.folder())
+	}
+	for _, folder := range folders {
+		if root == "" {
+			root = folder
+			continue
+		}
+		if filepath.VolumeName(root) != filepath.VolumeName(folder) {
+			return "", fmt.Errorf("can't package %v and %v into the same zip as they are in different volumes", root, folder)
+		}
+		for !isInside(root, folder) {
+			root = filepath.Dir(root)
+		}
+	}
+	//directories are given by name in the zip
+	for _, p := range paths {
+		if p.dir && p.path == root && filepath.Dir(root) != root {
+			return filepath.Dir(root), nil
+		}
+	}
+	return root, nil
+}
+
+//Returns true if path is folder or is inside it
+func isInside(folder, path string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+//Returns the path relative to the root with slashes
+func zipEntryName(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+//Returns the files to package: the referenced files along with the resources
+//they reference inside their folder, and the contents of the referenced
+//directories. Hidden files and folders inside the directories are left out
+func packagedFiles(paths map[string]*localPath) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	var addFile func(file, folder string)
+	addFile = func(file, folder string) {
+		if seen[file] {
+			return
+		}
+		seen[file] = true
+		files = append(files, file)
+		for _, ref := range fileReferences(file, folder) {
+			addFile(ref, folder)
+		}
+	}
+	for _, p := range paths {
+		if !p.dir {
+			addFile(p.path, p.folder())
+			continue
+		}
+		err := filepath.Walk(p.path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != p.path && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() && !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+//Returns the existing local files inside folder referenced by the document or
+//css file. Documents that can't be parsed are sent without their references
+func fileReferences(file, folder string) (refs []string) {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext != ".css" && !documentExtensions[ext] {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	values := []string{}
+	if ext == ".css" {
+		css, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil
+		}
+		values = cssReferences(string(css))
+	} else if values, err = documentReferences(f); err != nil {
+		log.Printf("The references of %v are not packaged: %v", file, err)
+	}
+	for _, value := range values {
+		if ref, ok := resolveReference(file, value, folder); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+//Returns the values of the reference attributes, the stylesheet processing
+//instructions and the urls in the style elements of the document. It's parsed
+//leniently so that html works as well
+func documentReferences(r io.Reader) (values []string, err error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	inStyle := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return values, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			inStyle = t.Name.Local == "style"
+			for _, attr := range t.Attr {
+				if referenceAttributes[attr.Name.Local] {
+					values = append(values, attr.Value)
+				}
+			}
+		case xml.EndElement:
+			inStyle = false
+		case xml.CharData:
+			if inStyle {
+				values = append(values, cssReferences(string(t))...)
+			}
+		case xml.ProcInst:
+			if t.Target == "xml-stylesheet" {
+				if match := stylesheetPIRe.FindSubmatch(t.Inst); match != nil {
+					values = append(values, string(match[1]))
+				}
+			}
+		}
+	}
+}
+
+//Returns the urls and imports of the stylesheet
+func cssReferences(css string) (values []string) {
+	for _, re := range []*regexp.Regexp{cssUrlRe, cssImportRe} {
+		for _, match := range re.FindAllStringSubmatch(css, -1) {
+			values = append(values, match[1])
+		}
+	}
+	return
+}
+
+//Returns the path of the existing local file the relative reference points to.
+//References out of folder, the one of the input document, are not followed so
+//that nothing but the document and its resources is sent
+func resolveReference(base, ref, folder string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "/") || isRemoteUri(ref) {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	path := filepath.Join(filepath.Dir(base), filepath.FromSlash(u.Path))
+	if !isInside(folder, path) {
+		log.Printf("%v is not packaged as it's outside %v", ref, folder)
+		return "", false
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+//Writer that fails once more than the limit is written to it
+type limitedWriter struct {
+	io.Writer
+	limit   int64
+	written int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.written+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("the files to send take more than %v (%v setting), package them yourself and use --data, or raise the limit", byteCount(l.limit), MAXDATA)
+	}
+	n, err := l.Writer.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+//Zips the files into a temporary file, adding an entry for the referenced
+//directories as well. The client library takes the data as bytes, so it's
+//only loaded once the zip is complete and within maxSize. Returns the zip and
+//the names of its entries
+func zipFiles(root string, paths map[string]*localPath, files []string, maxSize int64) (data []byte, entries map[string]bool, err error) {
+	tmp, err := ioutil.TempFile("", "dp2-data-")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	entries = map[string]bool{}
+	w := zip.NewWriter(&limitedWriter{Writer: tmp, limit: maxSize})
+	//so that empty directories are there too
+	for _, p := range paths {
+		if p.dir && !entries[p.entry] {
+			entries[p.entry] = true
+			if _, err = w.Create(p.entry); err != nil {
+				return
+			}
+		}
+	}
+	for _, file := range files {
+		var name string
+		if name, err = zipEntryName(root, file); err != nil {
+			return
+		}
+		if entries[name] {
+			continue
+		}
+		entries[name] = true
+		if err = addZipFile(w, file, name); err != nil {
+			return
+		}
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if data, err = ioutil.ReadFile(tmp.Name()); err != nil {
+		return
+	}
+	return data, entries, nil
+}
+
+//Copies the file into the zip entry
+func addZipFile(w *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entry, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+//Checks that the inputs and file options of the request are found in the data
+//zip given by the user
+func checkDataZip(req *JobRequest) error {
+	entries, err := dataEntries(req.Data)
+	if err != nil {
+		return err
+	}
+	return checkZipPaths(req, entries)
+}
+
+//Returns the names of the entries in the central directory of the zip
+func dataEntries(data []byte) (map[string]bool, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("the data is not a zip file: %v", err)
+	}
+	entries := map[string]bool{}
+	for _, f := range reader.File {
+		entries[strings.TrimPrefix(f.Name, "./")] = true
+	}
+	return entries, nil
+}
+
+//Checks that the inputs and file options of the request point to an entry of
+//the zip or to a folder containing entries. All the missing paths are reported
+//at once, along with the similar entries
+func checkZipPaths(req *JobRequest, entries map[string]bool) error {
+	missing := []string{}
+	check := func(name, value string) {
+		if isRemoteUri(value) || zipContains(entries, value) {
+			return
+		}
+		msg := fmt.Sprintf("--%v %v", name, value)
+		if similar := similarEntries(entries, value); len(similar) > 0 {
+			msg += fmt.Sprintf(" (did you mean %v?)", strings.Join(similar, ", "))
+		}
+		missing = append(missing, msg)
+	}
+	for name, values := range req.Inputs {
+		for _, value := range values {
+			check(name, value.Opaque)
+		}
+	}
+	for name := range req.FileOptions {
+		for _, value := range req.Options[name] {
+			check(name, value)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("Not found in the data zip:\n\t%v", strings.Join(missing, "\n\t"))
+	}
+	return nil
+}
+
+//Returns true if the path is an entry or a folder containing some entry
+func zipContains(entries map[string]bool, value string) bool {
+	name := path.Clean(value)
+	if entries[name] {
+		return true
+	}
+	for entry := range entries {
+		if strings.HasPrefix(entry, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	MAX_SUGGESTIONS = 3 //Maximum number of similar entries shown for a missing path
+)
+
+//Returns the entries that look like the missing path: those with the same file
+//name and, failing that, those a few edits away from it
+func similarEntries(entries map[string]bool, value string) []string {
+	name := strings.TrimSuffix(path.Clean(value), "/")
+	base := path.Base(name)
+	similar := []string{}
+	for entry := range entries {
+		if path.Base(strings.TrimSuffix(entry, "/")) == base {
+			similar = append(similar, entry)
+		}
+	}
+	if len(similar) == 0 {
+		maxDistance := len(name) / 3
+		if maxDistance < 2 {
+			maxDistance = 2
+		}
+		for entry := range entries {
+			if editDistance(name, strings.TrimSuffix(entry, "/")) <= maxDistance {
+				similar = append(similar, entry)
+			}
+		}
+	}
+	sort.Strings(similar)
+	if len(similar) > MAX_SUGGESTIONS {
+		similar = similar[:MAX_SUGGESTIONS]
+	}
+	return similar
+}
+
+//Levenshtein distance between the strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	res := values[0]
+	for _, v := range values[1:] {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
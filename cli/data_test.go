@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//Creates the files under a temporary folder, returns the folder
+func createTree(t *testing.T, files map[string]string) string {
+	folder, err := ioutil.TempDir("", "dp2-data-")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for name, body := range files {
+		path := filepath.Join(folder, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	return folder
+}
+
+func zipEntries(t *testing.T, data []byte) []string {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	names := []string{}
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPackageData(t *testing.T) {
+	folder := createTree(t, map[string]string{
+		"books/dtbook/book.xml":     `<?xml-stylesheet type="text/css" href="style.css"?><dtbook><img src="img/fig1.png"/><a href="#top"/><a href="http://daisy.org"/><img src="../shared/logo.png#x"/></dtbook>`,
+		"books/dtbook/img/fig1.png": "png",
+		"books/dtbook/style.css":    "body { background: url('img/bg.png') }",
+		"books/dtbook/img/bg.png":   "png",
+		"books/dtbook/unused.xml":   "<unused/>",
+		"books/dtbook/.hidden":      "secret",
+		"books/shared/logo.png":     "png",
+		"books/extra/other.xml":     "<other/>",
+		"books/extra/.hidden":       "secret",
+		"elsewhere/ignored.txt":     "ignored",
+	})
+	defer os.RemoveAll(folder)
+	req := newJobRequest()
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: filepath.ToSlash(filepath.Join(folder, "books/dtbook/book.xml"))}}
+	req.Inputs["remote"] = []url.URL{url.URL{Opaque: "http://example.org/book.xml"}}
+	req.Options["extra"] = []string{filepath.Join(folder, "books", "extra")}
+	req.FileOptions["extra"] = true
+	req.Options["title"] = []string{"book.xml"}
+
+	if err := packageData(req, 0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//the references out of the folder of the document are left out
+	exp := []string{"dtbook/book.xml", "dtbook/img/bg.png", "dtbook/img/fig1.png", "dtbook/style.css", "extra/", "extra/other.xml"}
+	if entries := zipEntries(t, req.Data); strings.Join(entries, " ") != strings.Join(exp, " ") {
+		t.Errorf("Wrong zip entries %v", entries)
+	}
+	if req.Inputs["source"][0].String() != "dtbook/book.xml" {
+		t.Errorf("Input not rewritten %v", req.Inputs["source"][0].String())
+	}
+	if req.Inputs["remote"][0].String() != "http://example.org/book.xml" {
+		t.Errorf("Remote input shouldn't be rewritten %v", req.Inputs["remote"][0].String())
+	}
+	if req.Options["extra"][0] != "extra/" {
+		t.Errorf("Directory option not rewritten %v", req.Options["extra"][0])
+	}
+	if req.Options["title"][0] != "book.xml" {
+		t.Errorf("Non file option rewritten %v", req.Options["title"][0])
+	}
+}
+
+//Checks that the zip is not built past the size limit
+func TestPackageDataLimit(t *testing.T) {
+	//so that it can't be compressed
+	png := make([]byte, 4096)
+	rand.Read(png)
+	folder := createTree(t, map[string]string{
+		"book.xml": `<dtbook><img src="big.png"/></dtbook>`,
+		"big.png":  string(png),
+	})
+	defer os.RemoveAll(folder)
+	req := newJobRequest()
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: filepath.ToSlash(filepath.Join(folder, "book.xml"))}}
+	if err := packageData(req, 1024); err == nil || !strings.Contains(err.Error(), MAXDATA) {
+		t.Errorf("Expected a size error, got %v", err)
+	}
+	if req.Data != nil {
+		t.Errorf("No data should've been packaged")
+	}
+	if err := packageData(req, 1024*1024); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+//Checks the references found in html documents and stylesheets
+func TestFileReferences(t *testing.T) {
+	folder := createTree(t, map[string]string{
+		"index.html":    `<html><head><link rel="stylesheet" href="css/main.css"><style>h1 { background: url(h1.png) }</style></head><body><img src="a%20b.png"><br><img src="data:image/png;base64,AAAA"><a href="missing.html">x</a></body></html>`,
+		"css/main.css":  `@import "extra.css"; p { background: url("../p.png") }`,
+		"css/extra.css": "",
+		"h1.png":        "png",
+		"a b.png":       "png",
+		"p.png":         "png",
+	})
+	defer os.RemoveAll(folder)
+	refs := fileReferences(filepath.Join(folder, "index.html"), folder)
+	for idx, ref := range refs {
+		refs[idx], _ = filepath.Rel(folder, ref)
+	}
+	sort.Strings(refs)
+	exp := []string{"a b.png", filepath.Join("css", "main.css"), "h1.png"}
+	if strings.Join(refs, ",") != strings.Join(exp, ",") {
+		t.Errorf("Wrong references %v", refs)
+	}
+	refs = fileReferences(filepath.Join(folder, "css", "main.css"), folder)
+	if len(refs) != 2 {
+		t.Errorf("Wrong css references %v", refs)
+	}
+	//from the folder of the stylesheet, ../p.png is out of it
+	refs = fileReferences(filepath.Join(folder, "css", "main.css"), filepath.Join(folder, "css"))
+	if len(refs) != 1 {
+		t.Errorf("References out of the folder should be left out %v", refs)
+	}
+}
+
+func TestPackageDataMissingFile(t *testing.T) {
+	req := newJobRequest()
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: "/not/there/book.xml"}}
+	if err := packageData(req, 0); err == nil || !strings.Contains(err.Error(), "--source") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if req.Data != nil {
+		t.Errorf("No data should've been packaged")
+	}
+}
+
+func TestPackageDataUserZip(t *testing.T) {
+	data := createZipEntry(t, &zip.FileHeader{Name: "book.xml"}, "<dtbook/>")
+	req := newJobRequest()
+	req.Data = data
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: "./book.xml"}}
+	if err := packageData(req, 0); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(req.Data, data) || req.Inputs["source"][0].Opaque != "./book.xml" {
+		t.Errorf("The user data was modified")
+	}
+	//every missing path is reported
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: "books.xml"}, url.URL{Opaque: "other.xml"}}
+	err := packageData(req, 0)
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	for _, exp := range []string{"--source books.xml (did you mean book.xml?)", "--source other.xml"} {
+		if !strings.Contains(err.Error(), exp) {
+			t.Errorf("%q not found in %v", exp, err)
+		}
+	}
+}
+
+func TestSimilarEntries(t *testing.T) {
+	entries := map[string]bool{"books/book.xml": true, "books/img/": true, "books/img/fig.png": true, "notes.txt": true}
+	tests := []struct {
+		value string
+		exp   string
+	}{
+		{"book.xml", "books/book.xml"},
+		{"book/img/fig.png", "books/img/fig.png"},
+		{"books/imgs", "books/img/"},
+		{"completely/unrelated.odt", ""},
+	}
+	for _, test := range tests {
+		if res := strings.Join(similarEntries(entries, test.value), ","); res != test.exp {
+			t.Errorf("Wrong suggestion for %v: %q", test.value, res)
+		}
+	}
+}
+
+func TestDataOptionNotZip(t *testing.T) {
+	config := copyConf()
+	config[STARTING] = false
+	pipeline := newPipelineTest(false)
+	pipeline.fsallow = false
+	pipeline.withScripts = false
+	link := &PipelineLink{pipeline: pipeline, config: config}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	file := filepath.Join(os.TempDir(), "dp2_not_a_zip.zip")
+	ioutil.WriteFile(file, []byte("not a zip"), 0644)
+	defer os.Remove(file)
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", file, "--test-opt", "./myfile.xml"})
+	if err == nil || !strings.Contains(err.Error(), "not a zip") {
+		t.Errorf("A file that is not a zip was accepted as data (%v)", err)
+	}
+}
+
+func TestCheckZipPaths(t *testing.T) {
+	entries := map[string]bool{"book/book.xml": true, "book/img/fig.png": true}
+	req := newJobRequest()
+	req.Inputs["source"] = []url.URL{url.URL{Opaque: "book/book.xml"}, url.URL{Opaque: "book/missing.xml"}}
+	req.Options["images"] = []string{"book/img/"}
+	req.FileOptions["images"] = true
+	req.Options["css"] = []string{"book/img"}
+	req.FileOptions["css"] = true
+	err := checkZipPaths(req, entries)
+	if err == nil || !strings.Contains(err.Error(), "book/missing.xml") || strings.Contains(err.Error(), "book/img") {
+		t.Errorf("Wrong check result %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	PROGRESS_REFRESH = 200 * time.Millisecond //minimum time between progress updates
+)
+
+//Implemented by the pipeline accessors able to download the results from an
+//offset on
+type rangeResults interface {
+	ResultsFrom(id string, offset int64, w io.Writer) (bool, error)
+}
+
+//Downloads the results from the given offset on. If the pipeline doesn't
+//support ranged downloads the results are downloaded again skipping the
+//bytes already received
+func (p PipelineLink) resultsFrom(jobId string, offset int64, w io.Writer) (bool, error) {
+	if offset == 0 {
+		return p.pipeline.Results(jobId, w)
+	}
+	if ranged, ok := p.pipeline.(rangeResults); ok {
+		return ranged.ResultsFrom(jobId, offset, w)
+	}
+	return p.pipeline.Results(jobId, &skipWriter{Writer: w, skip: offset})
+}
+
+//Downloads the results of the job to w. When the download is interrupted by
+//a transient error it's resumed from the last byte received, as long as the
+//previous attempt made some progress. The bytes received are reported to
+//progress, if not nil
+func (p PipelineLink) DownloadResults(jobId string, w io.Writer, progress io.Writer) (ok bool, err error) {
+	last := time.Time{}
+	counter := &countingWriter{Writer: w}
+	if progress != nil {
+		counter.onWrite = func(written int64) {
+			if now := time.Now(); now.Sub(last) >= PROGRESS_REFRESH {
+				last = now
+				fmt.Fprintf(progress, "\rReceived %v", byteCount(written))
+			}
+		}
+		defer func() {
+			if counter.written > 0 {
+				fmt.Fprintf(progress, "\rReceived %v\n", byteCount(counter.written))
+			}
+		}()
+	}
+	for {
+		offset := counter.written
+		ok, err = p.resultsFrom(jobId, offset, counter)
+		if err == nil || !isTransient(err) || counter.written == offset {
+			return
+		}
+		log.Printf("Results download interrupted after %v (%v), resuming", byteCount(counter.written), err)
+	}
+}
+
+//Returns the writer where the download progress is shown, stderr if it's a
+//terminal and nil otherwise
+func progressOutput() io.Writer {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+	return os.Stderr
+}
+
+//Human readable size
+func byteCount(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
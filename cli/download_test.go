@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadResultsResume(t *testing.T) {
+	mock := newPipelineTest(false)
+	mock.SetVal([]byte("PK0123456789"))
+	flaky := &flakyPipeline{PipelineTest: mock, failures: 1, err: io.ErrUnexpectedEOF, written: []byte("PK01")}
+	link := PipelineLink{pipeline: flaky, config: copyConf()}
+	var buf, progress bytes.Buffer
+	ok, err := link.DownloadResults("id", &buf, &progress)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result %v %v", ok, err)
+	}
+	if buf.String() != "PK0123456789" {
+		t.Errorf("Wrong resumed download %q", buf.String())
+	}
+	if flaky.calls != 2 {
+		t.Errorf("Wrong number of calls %v", flaky.calls)
+	}
+	if !strings.Contains(progress.String(), "Received 12 B") {
+		t.Errorf("Progress not reported %q", progress.String())
+	}
+}
+
+func TestDownloadResultsNoProgress(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 2, err: io.EOF}
+	link := PipelineLink{pipeline: flaky, config: copyConf()}
+	var buf bytes.Buffer
+	if _, err := link.DownloadResults("id", &buf, nil); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Errorf("A download without progress was resumed")
+	}
+	//permanent errors are not resumed
+	flaky = &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 1, err: errors.New("Job not found"), written: []byte("PK")}
+	link = PipelineLink{pipeline: flaky, config: copyConf()}
+	if _, err := link.DownloadResults("id", &buf, nil); err == nil {
+		t.Errorf("Expected error")
+	}
+	if flaky.calls != 1 {
+		t.Errorf("A permanent error was resumed")
+	}
+}
+
+func TestSkipWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &skipWriter{Writer: &buf, skip: 5}
+	for _, chunk := range []string{"abc", "defg", "hij"} {
+		n, err := w.Write([]byte(chunk))
+		if err != nil || n != len(chunk) {
+			t.Errorf("Unexpected write result %v %v", n, err)
+		}
+	}
+	if buf.String() != "fghij" {
+		t.Errorf("Wrong data written %q", buf.String())
+	}
+}
+
+func TestResultsFromRange(t *testing.T) {
+	data := "PK0123456789"
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws/jobs/id/result" {
+			http.NotFound(w, r)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		var offset int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+		w.Header().Set("Content-Range", "bytes "+strconv.Itoa(offset)+"-"+strconv.Itoa(len(data)-1)+"/"+strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, data[offset:])
+	}))
+	defer server.Close()
+	conf := retryConf(0, 10)
+	conf[HOST] = server.URL[:strings.LastIndex(server.URL, ":")]
+	conf[PORT], _ = strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+	conf[PATH] = "ws"
+	api := newRetryPipeline(newPipelineTest(false), conf)
+	var buf bytes.Buffer
+	ok, err := api.ResultsFrom("id", 4, &buf)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result %v %v", ok, err)
+	}
+	if buf.String() != "23456789" {
+		t.Errorf("Wrong data %q", buf.String())
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=4-" {
+		t.Errorf("Wrong range requested %v", ranges)
+	}
+	if ok, err := api.ResultsFrom("other", 4, &buf); ok || err != nil {
+		t.Errorf("Missing results should return false %v %v", ok, err)
+	}
+}
+
+//Checks the signature against one computed apart from this code, with the
+//HMAC-SHA1 of the webservice's authentication scheme
+func TestSignUrl(t *testing.T) {
+	now := time.Date(2026, 10, 16, 11, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	signed := signUrl("http://localhost:8181/ws/jobs/job-1/result", "clientid", "supersecret", now, "0123456789abcdef0123456789abcd")
+	expected := "http://localhost:8181/ws/jobs/job-1/result?authid=clientid&time=2026-10-16T09:30:00Z&nonce=0123456789abcdef0123456789abcd&sign=hYJozKstuodjXj6Mzdz4wUFyezQ%3D"
+	if signed != expected {
+		t.Errorf("Wrong signature\n%v\nexpected\n%v", signed, expected)
+	}
+	signed = signUrl("http://localhost:8181/ws/jobs?x=1", "clientid", "supersecret", now, "n")
+	if !strings.HasPrefix(signed, "http://localhost:8181/ws/jobs?x=1&authid=clientid&") {
+		t.Errorf("The parameters should be appended to the query %v", signed)
+	}
+}
+
+//Checks that the ranged requests are signed when the webservice requires
+//authentication
+func TestResultsFromAuthenticated(t *testing.T) {
+	data := "PK0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("authid") != "client" || query.Get("nonce") == "" || query.Get("time") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		raw := "http://" + r.Host + r.URL.RequestURI()
+		unsigned := raw[:strings.Index(raw, "&sign=")]
+		mac := hmac.New(sha1.New, []byte("secret"))
+		mac.Write([]byte(unsigned))
+		if query.Get("sign") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var offset int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, data[offset:])
+	}))
+	defer server.Close()
+	api := newRetryPipeline(newPipelineTest(false), retryConf(0, 10))
+	api.SetUrl(server.URL + "/ws/")
+	api.SetCredentials("client", "secret")
+	var buf bytes.Buffer
+	ok, err := api.ResultsFrom("id", 4, &buf)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result %v %v", ok, err)
+	}
+	if buf.String() != "23456789" {
+		t.Errorf("Wrong data %q", buf.String())
+	}
+	api.SetCredentials("client", "wrong")
+	if _, err := api.ResultsFrom("id", 4, &buf); ExitCode(err) == 0 {
+		t.Errorf("Expected error with the wrong secret")
+	}
+}
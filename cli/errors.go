@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/capitancambio/go-subcommand"
+)
+
+//Process exit codes
+const (
+	EXIT_FAILURE        = 1 //Some of the operations failed
+	EXIT_USAGE          = 2 //Wrong command, flags or arguments
+	EXIT_JOB_FAIL       = 3 //A job finished with status FAIL
+	EXIT_JOB_ERROR      = 4 //A job finished with status ERROR
+	EXIT_TIMEOUT        = 5 //A job did not finish in the given time
+	EXIT_INVALID        = 6 //The validation report of a job has errors
+	EXIT_CONNECTION     = 7 //The webservice couldn't be reached
+	EXIT_AUTHENTICATION = 8 //The webservice rejected the credentials
+	EXIT_SERVER         = 9 //The webservice failed to process the request
+)
+
+//Description of the exit codes, as printed by help exit-codes
+var exitCodes = []struct {
+	Code        int
+	Description string
+}{
+	{0, "Success"},
+	{EXIT_FAILURE, "Any other error, or some of the operations of the command failed"},
+	{EXIT_USAGE, "Wrong command, flags or arguments"},
+	{EXIT_JOB_FAIL, "A job finished with status FAIL"},
+	{EXIT_JOB_ERROR, "A job finished with status ERROR"},
+	{EXIT_TIMEOUT, "A job did not finish in the time given to wait"},
+	{EXIT_INVALID, "The validation report of a job has errors (--report)"},
+	{EXIT_CONNECTION, "The webservice couldn't be reached or started"},
+	{EXIT_AUTHENTICATION, "The webservice rejected the credentials, or they are missing"},
+	{EXIT_SERVER, "The webservice failed to process the request"},
+}
+
+//Name of the help topic that lists the exit codes
+const EXIT_CODES_TOPIC = "exit-codes"
+
+//Returned when waiting for a job takes longer than allowed
+var errTimeout = errors.New("timeout")
+
+//Returned when the user stops following a job, which keeps running
+var errDetached = errors.New("detached")
+
+//Error that defines the exit code of the process
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e ExitError) Error() string {
+	return e.Message
+}
+
+//The command line is wrong: unknown command or flag, missing arguments...
+type UsageError struct {
+	Err error
+}
+
+func (e UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e UsageError) Unwrap() error {
+	return e.Err
+}
+
+//The webservice couldn't be reached or started
+type ConnectionError struct {
+	Err error
+}
+
+func (e ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+//The webservice rejected the credentials or they are missing
+type AuthenticationError struct {
+	Err error
+}
+
+func (e AuthenticationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e AuthenticationError) Unwrap() error {
+	return e.Err
+}
+
+//The webservice failed while processing the request
+type ServerError struct {
+	Err error
+}
+
+func (e ServerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ServerError) Unwrap() error {
+	return e.Err
+}
+
+//The jobs finished with status FAIL or ERROR
+type JobError struct {
+	Ids    []string
+	Status string
+}
+
+func (e JobError) Error() string {
+	if len(e.Ids) == 1 {
+		return fmt.Sprintf("Job %v finished with status %v", e.Ids[0], e.Status)
+	}
+	return fmt.Sprintf("Jobs %v finished with status %v", strings.Join(e.Ids, ", "), e.Status)
+}
+
+//Gives a type to the errors from the command line parser and the webservice,
+//so that they get their exit code. The errors already typed are returned as
+//they are, and the ones wrapping a typed error (as the http client does with
+//the errors of the transport) get its type
+func classifyError(err error) error {
+	switch err.(type) {
+	case nil, ExitError, UsageError, ConnectionError, AuthenticationError, ServerError, JobError:
+		return err
+	case subcommand.ParsingError:
+		return UsageError{err}
+	}
+	var auth AuthenticationError
+	var server ServerError
+	var conn ConnectionError
+	switch {
+	case errors.As(err, &auth):
+		return AuthenticationError{err}
+	case errors.As(err, &server):
+		return ServerError{err}
+	case errors.As(err, &conn), isNetworkError(err):
+		return ConnectionError{err}
+	}
+	return err
+}
+
+//Returns the exit code associated to the error, EXIT_FAILURE if its kind
+//doesn't define one
+func ExitCode(err error) int {
+	switch e := classifyError(err).(type) {
+	case nil:
+		return 0
+	case ExitError:
+		return e.Code
+	case UsageError:
+		return EXIT_USAGE
+	case ConnectionError:
+		return EXIT_CONNECTION
+	case AuthenticationError:
+		return EXIT_AUTHENTICATION
+	case ServerError:
+		return EXIT_SERVER
+	case JobError:
+		if e.Status == "ERROR" {
+			return EXIT_JOB_ERROR
+		}
+		return EXIT_JOB_FAIL
+	}
+	return EXIT_FAILURE
+}
+
+//Prints the exit codes and their meaning
+func printExitCodes(w io.Writer) {
+	fmt.Fprint(w, "\nExit codes:\n\n")
+	for _, code := range exitCodes {
+		fmt.Fprintf(w, "        %-3d %v\n", code.Code, code.Description)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/capitancambio/go-subcommand"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{errors.New("Something went wrong"), EXIT_FAILURE},
+		{subcommand.ParsingError{Description: "Unknown flag"}, EXIT_USAGE},
+		{UsageError{errors.New("Command status needs a job id")}, EXIT_USAGE},
+		{JobError{[]string{"job1"}, "FAIL"}, EXIT_JOB_FAIL},
+		{JobError{[]string{"job1", "job2"}, "ERROR"}, EXIT_JOB_ERROR},
+		{ExitError{EXIT_TIMEOUT, "Timeout"}, EXIT_TIMEOUT},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, EXIT_CONNECTION},
+		{&url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs", Err: statusError{"GET", "/ws/jobs", 401, "401 Unauthorized", ""}.typed()}, EXIT_AUTHENTICATION},
+		{&url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs", Err: statusError{"GET", "/ws/jobs", 500, "500 Internal Server Error", ""}.typed()}, EXIT_SERVER},
+		{&url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs", Err: timeoutError{10}}, EXIT_CONNECTION},
+		{fmt.Errorf("Error bringing the pipeline2 up %w", ConnectionError{errors.New("no java")}), EXIT_CONNECTION},
+	}
+	for _, test := range tests {
+		if code := ExitCode(test.err); code != test.code {
+			t.Errorf("Wrong exit code for %v: expected %v got %v", test.err, test.code, code)
+		}
+	}
+}
+
+//Checks that the errors are classified by their type and not by their message
+func TestExitCodeMessages(t *testing.T) {
+	for _, msg := range []string{
+		"job 3f401a0c-4010-4c2a-9f6a-a5e1d95c0bd0 not found",
+		"Forbidden characters in the nicename",
+		"cannot read book500.xml",
+		"Internal Server Error in the template",
+		"cannot open thereof.xml",
+		"connection refused.xml is not a valid file",
+	} {
+		if code := ExitCode(errors.New(msg)); code != EXIT_FAILURE {
+			t.Errorf("Wrong exit code for %q: expected %v got %v", msg, EXIT_FAILURE, code)
+		}
+	}
+	_, err := os.Open(filepath.Join(os.TempDir(), "dp2-missing", "book.xml"))
+	if code := ExitCode(err); code != EXIT_FAILURE {
+		t.Errorf("Wrong exit code for %v: expected %v got %v", err, EXIT_FAILURE, code)
+	}
+}
+
+func TestJobErrorMessage(t *testing.T) {
+	if msg := (JobError{[]string{"job1"}, "FAIL"}).Error(); msg != "Job job1 finished with status FAIL" {
+		t.Errorf("Wrong message %v", msg)
+	}
+	if msg := (JobError{[]string{"job1", "job2"}, "ERROR"}).Error(); msg != "Jobs job1, job2 finished with status ERROR" {
+		t.Errorf("Wrong message %v", msg)
+	}
+}
+
+//Checks that the errors returned by Run have their kind
+func TestRunUsageError(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	AddJobStatusCommand(cli, link)
+	err := cli.Run([]string{"status", "--unknown", "job1"})
+	if ExitCode(err) != EXIT_USAGE {
+		t.Errorf("Expected usage exit code for an unknown flag, got %v (%v)", ExitCode(err), err)
+	}
+	cli, link, _ = makeReturningCli(nil, t)
+	AddJobStatusCommand(cli, link)
+	err = cli.Run([]string{"status"})
+	if ExitCode(err) != EXIT_USAGE {
+		t.Errorf("Expected usage exit code for a missing id, got %v (%v)", ExitCode(err), err)
+	}
+}
+
+func TestHelpExitCodes(t *testing.T) {
+	cli, _, _ := makeReturningCli(nil, t)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	if err := cli.Run([]string{"help", EXIT_CODES_TOPIC}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, code := range exitCodes {
+		if exp := fmt.Sprintf("%-3d %v", code.Code, code.Description); !strings.Contains(buf.String(), exp) {
+			t.Errorf("%q not found in the help\n%v", exp, buf.String())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/capitancambio/go-subcommand"
+	"launchpad.net/goyaml"
+)
+
+//Output formats
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+	FORMAT_YAML = "yaml"
+)
+
+//Implemented by the values handed to the text templates that wrap the data
+//returned by the webservice with some printing hints. The raw data is what
+//gets serialised when a machine-readable format is selected.
+type rawDataHolder interface {
+	rawData() interface{}
+}
+
+//Checks that a string defines an output format
+func checkFormat(format string) bool {
+	return format == FORMAT_TEXT || format == FORMAT_JSON || format == FORMAT_YAML
+}
+
+//Adds the global output format option to the cli
+func (c *Cli) addFormatOption() {
+	c.AddOption("format", "", "Output format of the commands: text, json or yaml (default text)", "", "(text|json|yaml)", func(name, format string) error {
+		if !checkFormat(format) {
+			return fmt.Errorf("%s is not a valid format. Allowed values are text, json and yaml", format)
+		}
+		c.Format = format
+		return nil
+	}).SetCompletion(subcommand.Completion{Values: []string{FORMAT_TEXT, FORMAT_JSON, FORMAT_YAML}})
+}
+
+//Returns true if the output should be machine-readable
+func (c Cli) isStructured() bool {
+	return c.Format == FORMAT_JSON || c.Format == FORMAT_YAML
+}
+
+//Writes the data to the cli output in the selected machine-readable format.
+//Plain strings are wrapped into a {"message": ...} object so that the output
+//is always a document
+func (c *Cli) writeStructured(data interface{}) error {
+	if holder, ok := data.(rawDataHolder); ok {
+		data = holder.rawData()
+	}
+	if str, ok := data.(string); ok {
+		data = map[string]string{"message": strings.TrimSpace(str)}
+	}
+	out, err := marshal(data, c.Format)
+	if err != nil {
+		return err
+	}
+	_, err = c.Output.Write(out)
+	return err
+}
+
+//Writes the error to the cli output in the selected format as {"error": ...}.
+//Returns false if the selected format is text, so that the caller can print it
+//the usual way
+func (c *Cli) WriteError(err error) bool {
+	if !c.isStructured() {
+		return false
+	}
+	out, mErr := marshal(map[string]string{"error": err.Error()}, c.Format)
+	if mErr != nil {
+		return false
+	}
+	c.Output.Write(out)
+	return true
+}
+
+//Serialises the data as json or yaml. Both formats share the same keys, which
+//are the field names of the pipeline-clientlib-go structs (XMLName fields are
+//dropped as they only make sense for the xml representation)
+func marshal(data interface{}, format string) ([]byte, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	var plain interface{}
+	if err = decoder.Decode(&plain); err != nil {
+		return nil, err
+	}
+	plain = cleanPlain(plain)
+	switch format {
+	case FORMAT_YAML:
+		return goyaml.Marshal(plain)
+	default:
+		out, err := json.MarshalIndent(plain, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+}
+
+//Removes the XMLName entries and turns the json numbers into go numbers so
+//yaml does not quote them
+func cleanPlain(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		delete(v, "XMLName")
+		for key, inner := range v {
+			v[key] = cleanPlain(inner)
+		}
+	case []interface{}:
+		for idx, inner := range v {
+			v[idx] = cleanPlain(inner)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return val
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"launchpad.net/goyaml"
+)
+
+//Checks that the queue is serialised as json with the clientlib field names
+func TestQueueCommandJson(t *testing.T) {
+	cli, link, _ := makeReturningCli(queue, t)
+	r := overrideOutput(cli)
+	AddQueueCommand(cli, link)
+	err := cli.Run([]string{"--format", "json", "queue"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	var res []map[string]interface{}
+	if err := json.Unmarshal(r.Bytes(), &res); err != nil {
+		t.Errorf("Output is not json %v\n%s", err, r.String())
+		return
+	}
+	if len(res) != 1 {
+		t.Errorf("Wrong queue length %v", len(res))
+		return
+	}
+	if res[0]["Id"] != queue[0].Id {
+		t.Errorf("Wrong id %v", res[0]["Id"])
+	}
+	if res[0]["TimeStamp"] != float64(queue[0].TimeStamp) {
+		t.Errorf("Wrong timestamp %v", res[0]["TimeStamp"])
+	}
+}
+
+//Checks that only the job is serialised by the status command and that the
+//xml names are not part of the output
+func TestJobStatusCommandYaml(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	err := cli.Run([]string{"--format", "yaml", "status", "-v", "id"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	res := map[string]interface{}{}
+	if err := goyaml.Unmarshal(r.Bytes(), res); err != nil {
+		t.Errorf("Output is not yaml %v\n%s", err, r.String())
+		return
+	}
+	if res["Id"] != JOB_1.Id {
+		t.Errorf("Wrong id %v", res["Id"])
+	}
+	if _, ok := res["Verbose"]; ok {
+		t.Errorf("Printing hints shouldn't be serialised")
+	}
+	if strings.Contains(r.String(), "XMLName") {
+		t.Errorf("XMLName shouldn't be serialised\n%s", r.String())
+	}
+}
+
+//Checks that plain messages are wrapped into an object
+func TestDeleteCommandJson(t *testing.T) {
+	cli, link, _ := makeReturningCli(true, t)
+	r := overrideOutput(cli)
+	AddDeleteCommand(cli, link)
+	err := cli.Run([]string{"--format", "json", "delete", "id"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	res := map[string]string{}
+	if err := json.Unmarshal(r.Bytes(), &res); err != nil {
+		t.Errorf("Output is not json %v\n%s", err, r.String())
+		return
+	}
+	if res["message"] != "Job id removed from the server" {
+		t.Errorf("Wrong message %q", res["message"])
+	}
+}
+
+func TestFormatWrongValue(t *testing.T) {
+	cli, link, _ := makeReturningCli(queue, t)
+	AddQueueCommand(cli, link)
+	err := cli.Run([]string{"--format", "xml", "queue"})
+	if err == nil {
+		t.Errorf("Wrong format value didn't error")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	cli, _, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	if cli.WriteError(errors.New("oops")) {
+		t.Errorf("Errors shouldn't be written in text mode")
+	}
+	cli.Format = FORMAT_JSON
+	if !cli.WriteError(errors.New("oops")) {
+		t.Errorf("Error not written in json mode")
+	}
+	res := map[string]string{}
+	if err := json.Unmarshal(r.Bytes(), &res); err != nil {
+		t.Errorf("Output is not json %v\n%s", err, r.String())
+		return
+	}
+	if res["error"] != "oops" {
+		t.Errorf("Wrong error %q", res["error"])
+	}
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/capitancambio/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Statuses a job can be in
+var jobStatuses = []string{"IDLE", "RUNNING", "SUCCESS", "FAIL", "ERROR"}
+
+//Fields the job list can be sorted by
+var jobSortFields = map[string]func(pipeline.Job, map[string]time.Time) string{
+	"id":       func(j pipeline.Job, _ map[string]time.Time) string { return j.Id },
+	"status":   func(j pipeline.Job, _ map[string]time.Time) string { return j.Status },
+	"nicename": func(j pipeline.Job, _ map[string]time.Time) string { return j.Nicename },
+	"script":   func(j pipeline.Job, _ map[string]time.Time) string { return jobScript(j) },
+	"priority": func(j pipeline.Job, _ map[string]time.Time) string { return priorityRank(j.Priority) },
+	"time": func(j pipeline.Job, times map[string]time.Time) string {
+		if t, ok := times[j.Id]; ok {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+		return ""
+	},
+}
+
+//Criteria to select jobs, given through the flags added by addFlags so that
+//the commands dealing with several jobs share them
+type jobFilter struct {
+	statuses []string
+	nicename string
+	script   string
+	since    time.Time
+	until    time.Time
+	timeFlag string //flag that needs the job times, if any
+}
+
+//Adds the filter flags to the command
+func (f *jobFilter) addFlags(cmd *subcommand.Command) {
+	cmd.AddOption("status", "", fmt.Sprintf("Only the jobs with the status, several can be given separated by commas (%v)", strings.Join(jobStatuses, ", ")), "", "STATUS", func(name, value string) error {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			if !hasStatus(jobStatuses...)(pipeline.Job{Status: status}) {
+				return fmt.Errorf("%v is not a valid status. Allowed values are %v", status, strings.Join(jobStatuses, ", "))
+			}
+			f.statuses = append(f.statuses, status)
+		}
+		return nil
+	}).SetCompletion(subcommand.Completion{Values: jobStatuses})
+	cmd.AddOption("nicename", "", "Only the jobs whose nicename matches the pattern, * and ? are wildcards", "", "PATTERN", func(name, value string) error {
+		if _, err := path.Match(value, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %v: %v", value, err)
+		}
+		f.nicename = value
+		return nil
+	})
+	cmd.AddOption("script", "", "Only the jobs of the script", "", "ID", func(name, value string) error {
+		f.script = value
+		return nil
+	})
+	cmd.AddOption("since", "", "Only the jobs queued at or after the date (2006-01-02 or 2006-01-02T15:04:05) or the time ago (90m, 2h...). Needs --status IDLE", "", "TIME", func(name, value string) (err error) {
+		f.timeFlag = "--" + name
+		f.since, err = parseTimeLimit(value, time.Now())
+		return
+	})
+	cmd.AddOption("until", "", "Only the jobs queued at or before the date (2006-01-02 or 2006-01-02T15:04:05) or the time ago (90m, 2h...). Needs --status IDLE", "", "TIME", func(name, value string) (err error) {
+		f.timeFlag = "--" + name
+		f.until, err = parseTimeLimit(value, time.Now())
+		return
+	})
+}
+
+//The webservice only gives the time of the jobs in the execution queue, so the
+//flags that need it are rejected unless the filter only selects IDLE jobs.
+//flag is the one that needs the times, if any
+func (f jobFilter) checkTimes(flag string) error {
+	if flag == "" {
+		return nil
+	}
+	queued := len(f.statuses) > 0
+	for _, status := range f.statuses {
+		queued = queued && status == "IDLE"
+	}
+	if !queued {
+		return UsageError{fmt.Errorf("%v only applies to the queued jobs, as the webservice doesn't give the time of the others: add --status IDLE", flag)}
+	}
+	return nil
+}
+
+//Returns true if the filter needs the time of the jobs
+func (f jobFilter) needsTimes() bool {
+	return !f.since.IsZero() || !f.until.IsZero()
+}
+
+//Returns the predicate selecting the jobs, times are the known job times
+func (f jobFilter) predicate(times map[string]time.Time) jobPredicate {
+	preds := []jobPredicate{}
+	if len(f.statuses) > 0 {
+		preds = append(preds, hasStatus(f.statuses...))
+	}
+	if f.nicename != "" {
+		preds = append(preds, nicenameMatches(f.nicename))
+	}
+	if f.script != "" {
+		preds = append(preds, usesScript(f.script))
+	}
+	if f.needsTimes() {
+		preds = append(preds, timeBetween(times, f.since, f.until))
+	}
+	return and(preds...)
+}
+
+//Parses a date, a date and time or a duration, which is taken as the time
+//that long before now
+func parseTimeLimit(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%v is neither a date (2006-01-02 or 2006-01-02T15:04:05) nor a duration (90m, 2h...)", value)
+}
+
+//Checks the sort field, prefixed by - for a descending order
+func checkSortField(field string) error {
+	if _, ok := jobSortFields[strings.TrimPrefix(field, "-")]; !ok {
+		fields := make([]string, 0, len(jobSortFields))
+		for name := range jobSortFields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		return fmt.Errorf("%v is not a valid sort field. Allowed values are %v, prefixed by - for a descending order", field, strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+//Sorts the jobs by the field, prefixed by - for a descending order. Jobs with
+//the same value keep their order
+func sortJobs(js []pipeline.Job, field string, times map[string]time.Time) {
+	sort.Stable(jobsBy{js, jobSortFields[strings.TrimPrefix(field, "-")], times, strings.HasPrefix(field, "-")})
+}
+
+type jobsBy struct {
+	jobs  []pipeline.Job
+	key   func(pipeline.Job, map[string]time.Time) string
+	times map[string]time.Time
+	desc  bool
+}
+
+func (j jobsBy) Len() int      { return len(j.jobs) }
+func (j jobsBy) Swap(a, b int) { j.jobs[a], j.jobs[b] = j.jobs[b], j.jobs[a] }
+func (j jobsBy) Less(a, b int) bool {
+	if j.desc {
+		return j.key(j.jobs[a], j.times) > j.key(j.jobs[b], j.times)
+	}
+	return j.key(j.jobs[a], j.times) < j.key(j.jobs[b], j.times)
+}
+
+//So that high goes before medium and low
+func priorityRank(priority string) string {
+	switch priority {
+	case "high":
+		return "0"
+	case "medium":
+		return "1"
+	case "low":
+		return "2"
+	}
+	return "3"
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestParseTimeLimit(t *testing.T) {
+	now := time.Date(2014, 5, 16, 12, 0, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"2h":                  now.Add(-2 * time.Hour),
+		"2014-05-01":          time.Date(2014, 5, 1, 0, 0, 0, 0, time.Local),
+		"2014-05-01T10:30:00": time.Date(2014, 5, 1, 10, 30, 0, 0, time.Local),
+		"2014-05-01 10:30":    time.Date(2014, 5, 1, 10, 30, 0, 0, time.Local),
+	}
+	for value, exp := range tests {
+		res, err := parseTimeLimit(value, now)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !res.Equal(exp) {
+			t.Errorf("Wrong time for %v: %v", value, res)
+		}
+	}
+	if _, err := parseTimeLimit("yesterday", now); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestSortJobs(t *testing.T) {
+	jobs := []pipeline.Job{
+		{Id: "a", Priority: "low", Nicename: "b"},
+		{Id: "b", Priority: "high", Nicename: "c"},
+		{Id: "c", Priority: "medium", Nicename: "a"},
+	}
+	check := func(field string, exp ...string) {
+		sortJobs(jobs, field, nil)
+		for idx, id := range exp {
+			if jobs[idx].Id != id {
+				t.Errorf("Wrong order sorting by %v: %v", field, jobs)
+				return
+			}
+		}
+	}
+	check("priority", "b", "c", "a")
+	check("nicename", "c", "a", "b")
+	check("-id", "c", "b", "a")
+	if err := checkSortField("-time"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := checkSortField("size"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	LOG_FORMAT_JSONL = "jsonl"
+	LOG_FORMAT_JUNIT = "junit"
+)
+
+var logFormats = []string{LOG_FORMAT_JSONL, LOG_FORMAT_JUNIT}
+
+//Scripts whose ERROR messages are the validation errors found, each one is
+//reported as a failed test case in JUnit reports
+var validatorScripts = []string{"dtbook-validator", "nimas-fileset-validator"}
+
+//A job message as written in the jsonl format
+type messageRecord struct {
+	Sequence int    `json:"sequence"`
+	Level    string `json:"level"`
+	Depth    int    `json:"depth"`
+	Parent   *int   `json:"parent"` //null for the top level messages
+	Content  string `json:"content"`
+}
+
+//Writes a json record per message and line
+func writeJSONLines(w io.Writer, msgs []Message) error {
+	encoder := json.NewEncoder(w)
+	for _, msg := range msgs {
+		record := messageRecord{Sequence: msg.Sequence, Level: msg.Level, Depth: msg.Depth, Content: msg.Message}
+		if msg.Parent >= 0 {
+			parent := msg.Parent
+			record.Parent = &parent
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+//Builds the JUnit report of the job. The ERROR messages of validator scripts
+//are failed test cases, for the other scripts the job is the only test case,
+//failed if the job's status is FAIL. Jobs with status ERROR are errors
+func newJUnitReport(job pipeline.Job, msgs []Message) junitTestSuites {
+	script := jobScript(job)
+	name := job.Id
+	if job.Nicename != "" {
+		name = fmt.Sprintf("%v (%v)", job.Nicename, job.Id)
+	}
+	suite := junitTestSuite{Name: name}
+	errorMsgs := []string{}
+	out := []string{}
+	for _, msg := range msgs {
+		out = append(out, msg.String())
+		if levelRank(msg.Level) == 0 {
+			errorMsgs = append(errorMsgs, msg.Message)
+		}
+	}
+	suite.SystemOut = strings.Join(out, "\n")
+	errorText := strings.Join(errorMsgs, "\n")
+	if isValidator(script) {
+		for idx, msg := range errorMsgs {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				ClassName: script,
+				Name:      fmt.Sprintf("error %d: %v", idx+1, firstLine(msg)),
+				Failure:   &junitProblem{Message: firstLine(msg), Type: "ERROR", Text: msg},
+			})
+		}
+		if len(errorMsgs) == 0 && job.Status != "ERROR" {
+			validation := junitTestCase{ClassName: script, Name: "validation"}
+			if job.Status == "FAIL" {
+				validation.Failure = &junitProblem{Message: "The job finished with status FAIL", Type: job.Status}
+			}
+			suite.TestCases = append(suite.TestCases, validation)
+		}
+	} else if job.Status != "ERROR" {
+		run := junitTestCase{ClassName: script, Name: "job"}
+		if job.Status == "FAIL" {
+			run.Failure = &junitProblem{Message: "The job finished with status FAIL", Type: job.Status, Text: errorText}
+		}
+		suite.TestCases = append(suite.TestCases, run)
+	}
+	if job.Status == "ERROR" {
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			ClassName: script,
+			Name:      "job",
+			Error:     &junitProblem{Message: "The job finished with status ERROR", Type: job.Status, Text: errorText},
+		})
+	}
+	for _, testCase := range suite.TestCases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+		if testCase.Error != nil {
+			suite.Errors++
+		}
+	}
+	suite.Tests = len(suite.TestCases)
+	return junitTestSuites{Name: script, Tests: suite.Tests, Failures: suite.Failures, Errors: suite.Errors, Suites: []junitTestSuite{suite}}
+}
+
+//Writes the JUnit report of the job
+func writeJUnit(w io.Writer, job pipeline.Job, msgs []Message) error {
+	out, err := xml.MarshalIndent(newJUnitReport(job, msgs), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%v%s\n", xml.Header, out)
+	return err
+}
+
+func isValidator(script string) bool {
+	for _, validator := range validatorScripts {
+		if validator == script {
+			return true
+		}
+	}
+	return false
+}
+
+func firstLine(text string) string {
+	return strings.SplitN(text, "\n", 2)[0]
+}
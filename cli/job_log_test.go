@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestWriteJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSONLines(&buf, messageFilter{}.jobMessages(NESTED_JOB)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	exp := []string{
+		`{"sequence":1,"level":"INFO","depth":0,"parent":null,"content":"Converting"}`,
+		`{"sequence":2,"level":"DEBUG","depth":1,"parent":1,"content":"Step 1"}`,
+		`{"sequence":3,"level":"WARNING","depth":1,"parent":1,"content":"Missing alt"}`,
+		`{"sequence":4,"level":"TRACE","depth":2,"parent":3,"content":"Image 1"}`,
+		`{"sequence":5,"level":"ERROR","depth":0,"parent":null,"content":"Failed"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Wrong records\n%v", buf.String())
+	}
+}
+
+func validationJob(script, status string, errors ...string) pipeline.Job {
+	job := pipeline.Job{Id: "job", Status: status, Script: pipeline.Script{Id: script}}
+	for idx, msg := range errors {
+		job.Messages.Message = append(job.Messages.Message, pipeline.Message{Sequence: idx, Level: "ERROR", Content: msg})
+	}
+	job.Messages.Message = append(job.Messages.Message, pipeline.Message{Sequence: len(errors), Level: "INFO", Content: "Done"})
+	return job
+}
+
+func TestJUnitReport(t *testing.T) {
+	tests := []struct {
+		job                     pipeline.Job
+		tests, failures, errors int
+	}{
+		{validationJob("dtbook-validator", "FAIL", "Missing title", "Bad id\nat line 3"), 2, 2, 0},
+		{validationJob("nimas-fileset-validator", "SUCCESS"), 1, 0, 0},
+		{validationJob("dtbook-validator", "ERROR", "Crashed"), 2, 1, 1},
+		{validationJob("dtbook-to-epub3", "FAIL", "Missing title"), 1, 1, 0},
+		{validationJob("dtbook-to-epub3", "SUCCESS"), 1, 0, 0},
+		{validationJob("dtbook-to-epub3", "ERROR", "Crashed"), 1, 0, 1},
+	}
+	for _, test := range tests {
+		report := newJUnitReport(test.job, messageFilter{}.jobMessages(test.job))
+		if report.Tests != test.tests || report.Failures != test.failures || report.Errors != test.errors {
+			t.Errorf("Wrong counts for %v %v: %v tests %v failures %v errors", jobScript(test.job), test.job.Status, report.Tests, report.Failures, report.Errors)
+		}
+	}
+	job := validationJob("dtbook-validator", "FAIL", "Bad id\nat line 3")
+	report := newJUnitReport(job, messageFilter{}.jobMessages(job))
+	failure := report.Suites[0].TestCases[0].Failure
+	if failure == nil || failure.Message != "Bad id" || failure.Text != "Bad id\nat line 3" {
+		t.Errorf("Wrong failure %+v", failure)
+	}
+}
+
+func TestLogCommandJUnit(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddLogCommand(cli, link)
+	if err := cli.Run([]string{"log", "--format", "junit", "job1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	report := junitTestSuites{}
+	if err := xml.Unmarshal(r.Bytes(), &report); err != nil {
+		t.Fatalf("Not a junit report %v\n%v", err, r.String())
+	}
+	if report.Tests != 1 || !strings.Contains(report.Suites[0].SystemOut, "Message 2") {
+		t.Errorf("Wrong report\n%v", r.String())
+	}
+}
+
+func TestLogCommandFormatErrors(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	AddLogCommand(cli, link)
+	if err := cli.Run([]string{"log", "--format", "csv", "job1"}); err == nil {
+		t.Errorf("Expected error for an unknown format")
+	}
+	cli, link, _ = makeReturningCli(nil, t)
+	AddLogCommand(cli, link)
+	if err := cli.Run([]string{"log", "--format", "jsonl", "--follow", "job1"}); err == nil {
+		t.Errorf("Expected error when following")
+	}
+}
@@ -1,6 +1,12 @@
 package cli
 
-import "github.com/daisy/pipeline-clientlib-go"
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
 
 //functions that process jobs
 type jobFunc func(pipeline.Job, chan string)
@@ -8,14 +14,25 @@ type jobPredicate func(pipeline.Job) bool
 
 //applies the function to the jobs that fulfil the predicate
 func parallelMap(js []pipeline.Job, fn jobFunc, pred jobPredicate) []string {
+	return boundedMap(js, fn, pred, len(js))
+}
+
+//applies the function to the jobs that fulfil the predicate, to at most
+//workers jobs at the same time
+func boundedMap(js []pipeline.Job, fn jobFunc, pred jobPredicate, workers int) []string {
 
 	cnt := 0
 	cStr := make(chan string)
+	slots := make(chan bool, workers)
 
 	for _, j := range js {
 		if pred(j) {
 			cnt++
-			go fn(j, cStr)
+			go func(j pipeline.Job) {
+				slots <- true
+				defer func() { <-slots }()
+				fn(j, cStr)
+			}(j)
 
 		}
 	}
@@ -34,6 +51,10 @@ func isError(j pipeline.Job) bool {
 	return j.Status == "ERROR"
 }
 
+func isFinished(j pipeline.Job) bool {
+	return j.Status == "SUCCESS" || j.Status == "FAIL" || j.Status == "ERROR"
+}
+
 func or(fns ...jobPredicate) jobPredicate {
 	return func(j pipeline.Job) bool {
 		for _, fn := range fns {
@@ -44,3 +65,77 @@ func or(fns ...jobPredicate) jobPredicate {
 		return false
 	}
 }
+
+func and(fns ...jobPredicate) jobPredicate {
+	return func(j pipeline.Job) bool {
+		for _, fn := range fns {
+			if !fn(j) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func not(fn jobPredicate) jobPredicate {
+	return func(j pipeline.Job) bool {
+		return !fn(j)
+	}
+}
+
+//jobs with any of the statuses
+func hasStatus(statuses ...string) jobPredicate {
+	return func(j pipeline.Job) bool {
+		for _, status := range statuses {
+			if j.Status == status {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//jobs whose nicename matches the pattern, with * and ? as wildcards
+func nicenameMatches(pattern string) jobPredicate {
+	return func(j pipeline.Job) bool {
+		ok, err := path.Match(pattern, j.Nicename)
+		return err == nil && ok
+	}
+}
+
+//jobs of the script
+func usesScript(id string) jobPredicate {
+	return func(j pipeline.Job) bool {
+		return jobScript(j) == id
+	}
+}
+
+//jobs whose time is known and within the limits, zero limits are ignored
+func timeBetween(times map[string]time.Time, since, until time.Time) jobPredicate {
+	return func(j pipeline.Job) bool {
+		t, ok := times[j.Id]
+		if !ok {
+			return false
+		}
+		return (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+	}
+}
+
+//Returns the jobs that fulfil the predicate
+func filterJobs(js []pipeline.Job, pred jobPredicate) []pipeline.Job {
+	res := []pipeline.Job{}
+	for _, j := range js {
+		if pred(j) {
+			res = append(res, j)
+		}
+	}
+	return res
+}
+
+//Returns the id of the job's script, the job list may only give its href
+func jobScript(j pipeline.Job) string {
+	if j.Script.Id != "" {
+		return j.Script.Id
+	}
+	return path.Base(strings.TrimSuffix(j.Script.Href, "/"))
+}
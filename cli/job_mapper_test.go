@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/daisy/pipeline-clientlib-go"
 )
@@ -92,3 +95,74 @@ func TestMap(t *testing.T) {
 	}
 
 }
+
+func TestAndNot(t *testing.T) {
+	aye := func(pipeline.Job) bool {
+		return true
+	}
+	nay := func(pipeline.Job) bool {
+		return false
+	}
+	if !and(aye, aye)(pipeline.Job{}) {
+		t.Error("AND of true true should be true")
+	}
+	if and(aye, nay)(pipeline.Job{}) {
+		t.Error("AND of true false should be false")
+	}
+	if !and()(pipeline.Job{}) {
+		t.Error("AND of nothing should be true")
+	}
+	if not(aye)(pipeline.Job{}) || !not(nay)(pipeline.Job{}) {
+		t.Error("NOT doesn't negate the predicate")
+	}
+}
+
+func TestJobPredicates(t *testing.T) {
+	job := pipeline.Job{
+		Id:       "1",
+		Status:   "FAIL",
+		Nicename: "weekly books",
+		Script:   pipeline.Script{Href: "http://localhost:8181/ws/scripts/dtbook-to-epub3"},
+	}
+	if !hasStatus("SUCCESS", "FAIL")(job) || hasStatus("ERROR")(job) {
+		t.Error("hasStatus doesn't check the status")
+	}
+	if !nicenameMatches("weekly*")(job) || nicenameMatches("daily*")(job) {
+		t.Error("nicenameMatches doesn't check the nicename")
+	}
+	if !usesScript("dtbook-to-epub3")(job) {
+		t.Error("usesScript doesn't take the script from the href")
+	}
+	now := time.Now()
+	times := map[string]time.Time{"1": now}
+	if !timeBetween(times, now.Add(-time.Hour), time.Time{})(job) || timeBetween(times, time.Time{}, now.Add(-time.Hour))(job) {
+		t.Error("timeBetween doesn't check the limits")
+	}
+	if timeBetween(map[string]time.Time{}, now.Add(-time.Hour), time.Time{})(job) {
+		t.Error("Jobs without time shouldn't match")
+	}
+}
+
+func TestBoundedMap(t *testing.T) {
+	jobs := []pipeline.Job{}
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, pipeline.Job{Id: fmt.Sprintf("%v", i)})
+	}
+	running := int32(0)
+	max := int32(0)
+	fn := func(j pipeline.Job, c chan string) {
+		if n := atomic.AddInt32(&running, 1); n > atomic.LoadInt32(&max) {
+			atomic.StoreInt32(&max, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		c <- j.Id
+	}
+	res := boundedMap(jobs, fn, and(), 3)
+	if len(res) != len(jobs) {
+		t.Errorf("Wrong number of results %v", len(res))
+	}
+	if max > 3 {
+		t.Errorf("More than 3 jobs processed at the same time (%v)", max)
+	}
+}
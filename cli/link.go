@@ -55,7 +55,7 @@ type PipelineLink struct {
 func NewLink(conf Config) (pLink *PipelineLink) {
 
 	pLink = &PipelineLink{
-		pipeline: pipeline.NewPipeline(conf.Url()),
+		pipeline: newRetryPipeline(pipeline.NewPipeline(conf.Url()), conf),
 		config:   conf,
 	}
 	//assure that the pipeline is up
@@ -66,13 +66,18 @@ func NewLink(conf Config) (pLink *PipelineLink) {
 func (p *PipelineLink) Init() error {
 	log.Println("Initialising link")
 	p.pipeline.SetUrl(p.config.Url())
+	if timeout, ok := p.config[TIMEOUT].(int); ok {
+		if retrying, ok := p.pipeline.(*retryPipeline); ok {
+			retrying.SetTimeout(timeout)
+		}
+	}
 	if err := bringUp(p); err != nil {
 		return err
 	}
 	//set the credentials
 	if p.Authentication {
 		if !(len(p.config[CLIENTKEY].(string)) > 0 && len(p.config[CLIENTSECRET].(string)) > 0) {
-			return errors.New("link: Authentication required but client_key and client_secret are not set. Please, check the configuration")
+			return AuthenticationError{errors.New("link: Authentication required but client_key and client_secret are not set. Please, check the configuration")}
 		}
 		p.pipeline.SetCredentials(p.config[CLIENTKEY].(string), p.config[CLIENTSECRET].(string))
 	}
@@ -82,6 +87,15 @@ func (p PipelineLink) IsLocal() bool {
 	return p.FsAllow
 }
 
+//Returns the maximum size in bytes of the data zip packaged for remote webservices
+func (p PipelineLink) maxDataSize() int64 {
+	mb, ok := p.config[MAXDATA].(int)
+	if !ok {
+		mb = config[MAXDATA].(int)
+	}
+	return int64(mb) * 1024 * 1024
+}
+
 //checks if the pipeline is up
 //otherwise it brings it up and fills the
 //link object
@@ -92,10 +106,10 @@ func bringUp(pLink *PipelineLink) error {
 			alive, err = NewPipelineLauncher(pLink.pipeline,
 				pLink.config.ExecPath(), pLink.config[TIMEOUT].(int)).Launch(os.Stdout)
 			if err != nil {
-				return fmt.Errorf("Error bringing the pipeline2 up %v", err.Error())
+				return ConnectionError{fmt.Errorf("Error bringing the pipeline2 up %v", err.Error())}
 			}
 		} else {
-			return fmt.Errorf("Could not connect to the webservice and I'm not configured to start one\n\tError: %v", err.Error())
+			return ConnectionError{fmt.Errorf("Could not connect to the webservice and I'm not configured to start one\n\tError: %v", err.Error())}
 		}
 	}
 	log.Println("Setting values")
@@ -184,6 +198,20 @@ func (p PipelineLink) Sizes() (sizes pipeline.JobSizes, err error) {
 func (p PipelineLink) Queue() (queue []pipeline.QueueJob, err error) {
 	return p.pipeline.Queue()
 }
+//Returns the time at which the jobs were queued. The webservice only gives it
+//for the jobs in the execution queue, the others are left out
+func (p PipelineLink) JobTimes() (times map[string]time.Time, err error) {
+	queue, err := p.pipeline.Queue()
+	if err != nil {
+		return
+	}
+	times = make(map[string]time.Time, len(queue))
+	for _, job := range queue {
+		times[job.Id] = time.Unix(0, job.TimeStamp*int64(time.Millisecond))
+	}
+	return
+}
+
 func (p PipelineLink) MoveUp(id string) (queue []pipeline.QueueJob, err error) {
 	return p.pipeline.MoveUp(id)
 }
@@ -196,6 +224,8 @@ type Message struct {
 	Message  string
 	Level    string
 	Depth    int
+	Sequence int
+	Parent   int //sequence of the enclosing message, -1 for the top level ones
 	Status   string
 	Progress float64
 	Error    error
@@ -204,15 +234,25 @@ type Message struct {
 //Returns a simple string representation of the messages strucutre:
 //[LEVEL]   Message content
 func (m Message) String() string {
+	return m.format(false)
+}
+
+//Same as String, with the level coloured if color is true
+func (m Message) format(color bool) string {
 	if m.Message != "" {
 		indent := ""
 		for i := 1; i <= m.Depth; i++ {
 			indent += "  "
 		}
 		level := "[" + m.Level + "]"
-		for len(level) < 10 {
-			level += " "
+		padding := ""
+		for len(level)+len(padding) < 10 {
+			padding += " "
+		}
+		if color {
+			level = levelColor(m.Level, level)
 		}
+		level += padding
 		str := ""
 		for i, line := range regexp.MustCompile("\r?\n|\r").Split(m.Message, -1) {
 			if (i == 0) {
@@ -241,52 +281,79 @@ func (p PipelineLink) Execute(jobReq JobRequest) (job pipeline.Job, messages cha
 	}
 	messages = make(chan Message)
 	if !jobReq.Background {
-		go getAsyncMessages(p, job.Id, messages)
+		go getAsyncMessages(p, job.Id, messages, nil)
 	} else {
 		close(messages)
 	}
 	return
 }
 
-//Feeds the channel with the messages describing the job's execution
-func getAsyncMessages(p PipelineLink, jobId string, messages chan Message) {
+//Returns a channel fed with the messages, status and progress of an existing job,
+//starting from its first message. The last message will contain the status in which the job finished.
+//Closing stop stops polling the job when the messages are no longer read
+func (p PipelineLink) Follow(jobId string, stop <-chan struct{}) chan Message {
+	messages := make(chan Message)
+	go getAsyncMessages(p, jobId, messages, stop)
+	return messages
+}
+
+//Feeds the channel with the messages describing the job's execution, until the
+//job finishes or stop is closed
+func getAsyncMessages(p PipelineLink, jobId string, messages chan Message, stop <-chan struct{}) {
+	defer close(messages)
+	send := func(msg Message) bool {
+		select {
+		case messages <- msg:
+			return true
+		case <-stop:
+			return false
+		}
+	}
 	msgNum := -1
 	for {
 		job, err := p.pipeline.Job(jobId, msgNum)
 		if err != nil {
-			messages <- Message{Error: err}
-			close(messages)
+			send(Message{Error: err})
 			return
 		}
 		n := msgNum
 		if len(job.Messages.Message) > 0 {
-			n = flattenMessages(job.Messages.Message, messages, job.Status, job.Messages.Progress, msgNum + 1, 0)
+			msgs := []Message{}
+			n = flattenMessages(job.Messages.Message, &msgs, job.Status, job.Messages.Progress, msgNum + 1, 0, -1)
+			for _, msg := range msgs {
+				if !send(msg) {
+					return
+				}
+			}
 		}
 		if (n > msgNum) {
 			msgNum = n
-		} else {
-			messages <- Message{Progress: job.Messages.Progress}
+		} else if !send(Message{Progress: job.Messages.Progress}) {
+			return
+		}
+		if isFinished(job) {
+			send(Message{Status: job.Status})
+			return
 		}
-		if job.Status == "SUCCESS" || job.Status == "ERROR" || job.Status == "FAIL" {
-			messages <- Message{Status: job.Status}
-			close(messages)
+		select {
+		case <-time.After(MSG_WAIT):
+		case <-stop:
 			return
 		}
-		time.Sleep(MSG_WAIT)
 	}
 
 }
 
-//Flatten message coming from the Pipeline job and feed them into the channel
+//Flatten message coming from the Pipeline job and append them to the list
 //Return the sequence number of the last inner message
-func flattenMessages(from []pipeline.Message, to chan Message, status string, progress float64, firstNum int, depth int) (lastNum int) {
+func flattenMessages(from []pipeline.Message, to *[]Message, status string, progress float64, firstNum int, depth int, parent int) (lastNum int) {
 	for _, msg := range from {
 		lastNum = msg.Sequence
 		if lastNum >= firstNum {
-			to <- Message{Message: msg.Content, Level: msg.Level, Depth: depth, Status: status, Progress: progress}
+			*to = append(*to, Message{Message: msg.Content, Level: msg.Level, Depth: depth, Sequence: msg.Sequence, Parent: parent, Status: status, Progress: progress})
 		}
 		if len(msg.Message) > 0 {
-			lastNum = flattenMessages(msg.Message, to, status, progress, firstNum, depth + 1)
+			lastNum = flattenMessages(msg.Message, to, status, progress, firstNum, depth + 1, msg.Sequence)
 		}
 	}
 	return lastNum
@@ -119,7 +119,7 @@ func TestNewLink(t *testing.T) {
 
 	link := NewLink(config)
 	{
-		res := link.pipeline.(*pipeline.Pipeline).BaseUrl
+		res := link.pipeline.(*retryPipeline).PipelineApi.(*pipeline.Pipeline).BaseUrl
 		expected := "www.daisy.org:8888/ws/"
 		if res != expected {
 			t.Errorf("The url has not been properly set '%s'!='%s'", res, expected)
@@ -365,7 +365,7 @@ func TestJobRequestToPipeline(t *testing.T) {
 func TestAsyncMessagesErr(t *testing.T) {
 	link := PipelineLink{pipeline: newPipelineTest(true)}
 	chMsg := make(chan Message)
-	go getAsyncMessages(link, "jobId", chMsg)
+	go getAsyncMessages(link, "jobId", chMsg, nil)
 	message := <-chMsg
 	if message.Error == nil {
 		t.Error("Expected error nil")
@@ -377,7 +377,7 @@ func TestAsyncMessages(t *testing.T) {
 	link := PipelineLink{pipeline: newPipelineTest(false)}
 	chMsg := make(chan Message)
 	var msgs []string
-	go getAsyncMessages(link, "jobId", chMsg)
+	go getAsyncMessages(link, "jobId", chMsg, nil)
 	for msg := range chMsg {
 		msgs = append(msgs, msg.Message)
 	}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/capitancambio/chalk"
+	"github.com/capitancambio/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Levels of the job messages, from the most to the least severe
+var messageLevels = []string{"ERROR", "WARNING", "INFO", "DEBUG", "TRACE"}
+
+//Selects the job messages that are printed, the zero value selects them all
+type messageFilter struct {
+	level      string //least severe level printed, all if empty
+	depth      int    //deepest nesting printed, the top level messages are at 0
+	limitDepth bool
+}
+
+//Adds --level and --depth to the command, wrap (if not nil) is applied to the
+//flag functions
+func (f *messageFilter) addFlags(cmd *subcommand.Command, wrap func(subcommand.FlagFunction) subcommand.FlagFunction) {
+	if wrap == nil {
+		wrap = func(fn subcommand.FlagFunction) subcommand.FlagFunction { return fn }
+	}
+	cmd.AddOption("level", "", fmt.Sprintf("Only prints the messages of the level or more severe (%v)", strings.Join(messageLevels, ", ")), "", italic("LEVEL"), wrap(f.setLevel)).
+		SetCompletion(subcommand.Completion{Values: messageLevels})
+	cmd.AddOption("depth", "", "Collapses the messages nested deeper than the depth, 0 only prints the top level ones", "", italic("DEPTH"), wrap(f.setDepth))
+}
+
+func (f *messageFilter) setLevel(name, value string) error {
+	level := strings.ToUpper(value)
+	if levelRank(level) == -1 {
+		return fmt.Errorf("%v is not a valid level. Allowed values are %v", value, strings.Join(messageLevels, ", "))
+	}
+	f.level = level
+	return nil
+}
+
+func (f *messageFilter) setDepth(name, value string) (err error) {
+	f.depth, err = strconv.Atoi(value)
+	if err != nil || f.depth < 0 {
+		return fmt.Errorf("--depth must be zero or a positive number (found %v)", value)
+	}
+	f.limitDepth = true
+	return nil
+}
+
+//Returns true if the filter selects something else than all the messages
+func (f messageFilter) filters() bool {
+	return f.level != "" || f.limitDepth
+}
+
+//Returns true if the message is printed. Messages with an unknown level are
+//always printed
+func (f messageFilter) accepts(m Message) bool {
+	if f.limitDepth && m.Depth > f.depth {
+		return false
+	}
+	return f.level == "" || levelRank(m.Level) <= levelRank(f.level)
+}
+
+//Returns the messages of the job selected by the filter
+func (f messageFilter) jobMessages(job pipeline.Job) (msgs []Message) {
+	flattened := []Message{}
+	flattenMessages(job.Messages.Message, &flattened, job.Status, job.Messages.Progress, 0, 0, -1)
+	for _, msg := range flattened {
+		if f.accepts(msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return
+}
+
+//Position of the level in messageLevels, -1 if unknown
+func levelRank(level string) int {
+	if level == "WARN" {
+		level = "WARNING"
+	}
+	for idx, l := range messageLevels {
+		if l == level {
+			return idx
+		}
+	}
+	return -1
+}
+
+//Colours the text according to the level
+func levelColor(level, text string) string {
+	switch levelRank(level) {
+	case 0:
+		return chalk.Red.Color(text)
+	case 1:
+		return chalk.Yellow.Color(text)
+	case 2:
+		return chalk.Cyan.Color(text)
+	case 3, 4:
+		return chalk.Dim.TextStyle(text)
+	}
+	return text
+}
+
+//Returns true if the stream (a writer or a reader) is a terminal
+func isTerminal(stream interface{}) bool {
+	file, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
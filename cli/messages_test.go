@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+var NESTED_JOB = pipeline.Job{
+	Id:     "nested",
+	Status: "SUCCESS",
+	Messages: pipeline.Messages{
+		Message: []pipeline.Message{
+			pipeline.Message{Sequence: 1, Level: "INFO", Content: "Converting", Message: []pipeline.Message{
+				pipeline.Message{Sequence: 2, Level: "DEBUG", Content: "Step 1"},
+				pipeline.Message{Sequence: 3, Level: "WARNING", Content: "Missing alt", Message: []pipeline.Message{
+					pipeline.Message{Sequence: 4, Level: "TRACE", Content: "Image 1"},
+				}},
+			}},
+			pipeline.Message{Sequence: 5, Level: "ERROR", Content: "Failed"},
+		},
+	},
+}
+
+func TestMessageFilter(t *testing.T) {
+	tests := []struct {
+		level string
+		depth string
+		exp   []string
+	}{
+		{"", "", []string{"Converting", "Step 1", "Missing alt", "Image 1", "Failed"}},
+		{"warning", "", []string{"Missing alt", "Failed"}},
+		{"INFO", "", []string{"Converting", "Missing alt", "Failed"}},
+		{"", "0", []string{"Converting", "Failed"}},
+		{"", "1", []string{"Converting", "Step 1", "Missing alt", "Failed"}},
+		{"DEBUG", "1", []string{"Converting", "Step 1", "Missing alt", "Failed"}},
+	}
+	for _, test := range tests {
+		filter := messageFilter{}
+		if test.level != "" {
+			if err := filter.setLevel("level", test.level); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		if test.depth != "" {
+			if err := filter.setDepth("depth", test.depth); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		res := []string{}
+		for _, msg := range filter.jobMessages(NESTED_JOB) {
+			res = append(res, msg.Message)
+		}
+		if strings.Join(res, ",") != strings.Join(test.exp, ",") {
+			t.Errorf("Wrong messages for level %q and depth %q: %v", test.level, test.depth, res)
+		}
+	}
+}
+
+func TestMessageFilterErrors(t *testing.T) {
+	filter := messageFilter{}
+	if err := filter.setLevel("level", "LOUD"); err == nil {
+		t.Errorf("Expected error for an unknown level")
+	}
+	if err := filter.setDepth("depth", "-1"); err == nil {
+		t.Errorf("Expected error for a negative depth")
+	}
+	if filter.filters() {
+		t.Errorf("Wrong values were kept")
+	}
+}
+
+//WARN is taken for WARNING and unknown levels are always printed
+func TestMessageFilterLevels(t *testing.T) {
+	filter := messageFilter{}
+	filter.setLevel("level", "WARNING")
+	if !filter.accepts(Message{Level: "WARN"}) {
+		t.Errorf("WARN messages not accepted")
+	}
+	if !filter.accepts(Message{Level: "FATAL"}) {
+		t.Errorf("Messages with unknown levels not accepted")
+	}
+}
+
+func TestMessageFormat(t *testing.T) {
+	msg := Message{Message: "Missing alt", Level: "WARNING", Depth: 1}
+	if res := msg.String(); res != "[WARNING]    Missing alt" {
+		t.Errorf("Wrong plain message %q", res)
+	}
+	res := msg.format(true)
+	plain := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(res, "")
+	if res == plain || plain != msg.String() {
+		t.Errorf("Wrong coloured message %q", res)
+	}
+}
+
+func TestPrintMessagesFilter(t *testing.T) {
+	msgs := []Message{}
+	flattenMessages(NESTED_JOB.Messages.Message, &msgs, "SUCCESS", 1, 0, 0, -1)
+	messages := make(chan Message, len(msgs))
+	for _, msg := range msgs {
+		messages <- msg
+	}
+	close(messages)
+	filter := messageFilter{}
+	filter.setLevel("level", "WARNING")
+	var buf bytes.Buffer
+	if _, err := printMessages(&buf, messages, true, filter, false, nil, nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if exp := "[WARNING]    Missing alt\n[ERROR]    Failed\n"; buf.String() != exp {
+		t.Errorf("Wrong messages %q", buf.String())
+	}
+}
+
+func TestLogCommandLevel(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddLogCommand(cli, link)
+	if err := cli.Run([]string{"log", "--level", "info", "job1"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if getCall(link) != JOB_CALL {
+		t.Errorf("The job messages weren't fetched")
+	}
+	if exp := "[INFO]     Message 1\n"; r.String() != exp {
+		t.Errorf("Wrong messages %q", r.String())
+	}
+}
+
+func TestVerboseJobStatusCommandLevel(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	if err := cli.Run([]string{"status", "-v", "--level", "INFO", "job1"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !strings.Contains(r.String(), "Message 1") || strings.Contains(r.String(), "Message 2") {
+		t.Errorf("The messages weren't filtered\n%v", r.String())
+	}
+}
+
+//Checks that the messages without status don't reset it
+func TestPrintMessagesTimeoutStatus(t *testing.T) {
+	messages := make(chan Message)
+	timeout := make(chan time.Time)
+	go func() {
+		messages <- Message{Message: "Running", Status: "RUNNING"}
+		messages <- Message{Progress: .5}
+		close(timeout)
+	}()
+	var buf bytes.Buffer
+	status, err := printMessages(&buf, messages, false, messageFilter{}, false, timeout, nil)
+	if err != errTimeout || status != "RUNNING" {
+		t.Errorf("Expected timeout with status RUNNING, got %q %v", status, err)
+	}
+}
+
+//Checks that detaching isn't taken for a timeout
+func TestPrintMessagesDetach(t *testing.T) {
+	messages := make(chan Message)
+	detach := make(chan struct{})
+	go func() {
+		messages <- Message{Message: "Running", Status: "RUNNING"}
+		close(detach)
+	}()
+	var buf bytes.Buffer
+	status, err := printMessages(&buf, messages, false, messageFilter{}, false, make(chan time.Time), detach)
+	if err != errDetached || status != "RUNNING" {
+		t.Errorf("Expected detached with status RUNNING, got %q %v", status, err)
+	}
+}
+
+//Checks that the job isn't polled anymore once stopped
+func TestFollowStop(t *testing.T) {
+	_, link, p := makeReturningCli(nil, t)
+	stop := make(chan struct{})
+	messages := link.Follow("job1", stop)
+	<-messages
+	close(stop)
+	for range messages {
+	}
+	calls := p.count
+	time.Sleep(2 * MSG_WAIT)
+	if p.count != calls {
+		t.Errorf("The job is still polled after stopping")
+	}
+}
@@ -28,6 +28,8 @@ const (
 	LIST_CLIENT_CALL   = "list_client"
 	PROPERTIES_CALL    = "properties"
 	SIZES_CALL         = "sizes"
+	SCRIPTS_CALL       = "scripts"
+	SCRIPT_CALL        = "script"
 )
 
 //Sets the output of the cli to a bytes.Buffer
@@ -80,6 +82,11 @@ func (f FailingWriter) Write([]byte) (int, error) {
 	return 0, errors.New("writing error")
 }
 
+//the tests don't share the script list through the cache
+func init() {
+	ScriptCachePath = ""
+}
+
 //Pipeline Mock
 type PipelineTest struct {
 	fail           bool
@@ -97,6 +104,7 @@ type PipelineTest struct {
 	withScripts    bool
 	jobs           func() (pipeline.Jobs, error)
 	delete         func(string) (bool, error)
+	job            func(string) (pipeline.Job, error)
 }
 
 func (p PipelineTest) mockCall() (val interface{}, err error) {
@@ -150,6 +158,7 @@ func (p *PipelineTest) Alive() (alive pipeline.Alive, err error) {
 }
 
 func (p *PipelineTest) Scripts() (scripts pipeline.Scripts, err error) {
+	p.call = SCRIPTS_CALL
 	if p.fail {
 		return scripts, errors.New("Error")
 	}
@@ -162,6 +171,7 @@ func (p *PipelineTest) Scripts() (scripts pipeline.Scripts, err error) {
 }
 
 func (p *PipelineTest) Script(id string) (script pipeline.Script, err error) {
+	p.call = SCRIPT_CALL
 	if p.fail {
 		return script, errors.New("Error")
 	}
@@ -181,6 +191,10 @@ func (p *PipelineTest) Job(id string, msgSeq int) (job pipeline.Job, err error)
 	if p.fail {
 		return job, errors.New("Error")
 	}
+	if p.job != nil {
+		p.count++
+		return p.job(id)
+	}
 	if p.count == 0 {
 		p.count++
 		return JOB_1, nil
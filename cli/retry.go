@@ -0,0 +1,467 @@
+package cli
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Returned when the webservice doesn't answer in the configured time
+type timeoutError struct {
+	seconds int
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("no response from the webservice after %v seconds", e.seconds)
+}
+
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+//Returned when the webservice answers with a status that the client library
+//would only report as a message: server errors and rejected credentials
+type statusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Message    string //what the webservice said about the error, if anything
+}
+
+func (e statusError) Error() string {
+	msg := fmt.Sprintf("The webservice answered %v to %v %v", e.Status, e.Method, e.Path)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+//Error document of the webservice
+type wsError struct {
+	Description string `xml:"description"`
+}
+
+//Reads what the webservice says in the body of an error answer: the
+//description of its error document or the first line of the text otherwise
+func errorMessage(body io.Reader) string {
+	data, _ := ioutil.ReadAll(io.LimitReader(body, 64*1024))
+	var doc wsError
+	if xml.Unmarshal(data, &doc) == nil && strings.TrimSpace(doc.Description) != "" {
+		return strings.TrimSpace(doc.Description)
+	}
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "<") {
+		return ""
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
+
+//Wraps the error in the type that gives its exit code
+func (e statusError) typed() error {
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return AuthenticationError{e}
+	}
+	return ServerError{e}
+}
+
+//Returns true if the request may succeed if it's sent again: the webservice
+//didn't answer in time, dropped the connection or is temporarily unavailable
+func isTransient(err error) bool {
+	var status statusError
+	if errors.As(err, &status) {
+		switch status.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.EPIPE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary())
+}
+
+//Returns true if the webservice couldn't be reached or the connection with it
+//was lost. The answers with an error status are left out, and so are the
+//local errors (the system errors are net.Errors too)
+func isNetworkError(err error) bool {
+	var status statusError
+	if errors.As(err, &status) {
+		return false
+	}
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return isTransient(err) || errors.As(err, &urlErr) || errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+//Returns a transport that applies the timeout to the requests sent through it.
+//It has its own copy of the default transport, so the dial and handshake
+//timeouts don't change the one used by the rest of the program
+func newTimeoutTransport(seconds int) http.RoundTripper {
+	base := http.RoundTripper(&http.Transport{Proxy: http.ProxyFromEnvironment})
+	if def, ok := defaultTransport.(*http.Transport); ok {
+		base = def.Clone()
+	}
+	if transport, ok := base.(*http.Transport); ok && seconds > 0 {
+		timeout := time.Duration(seconds) * time.Second
+		transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = timeout
+	}
+	return deadlineTransport{base: base, seconds: seconds}
+}
+
+//The default transport as it was before routeWebservice replaced it
+var defaultTransport = http.DefaultTransport
+
+//The client library can't be given a transport, it always goes through the
+//default one. It's replaced by one that sends the requests for the webservice
+//through the link's transport and leaves the others to the original one
+func routeWebservice(wsUrl string, transport http.RoundTripper) {
+	u, err := url.Parse(wsUrl)
+	if err != nil {
+		return
+	}
+	http.DefaultTransport = hostTransport{base: defaultTransport, host: u.Host, transport: transport}
+}
+
+//Sends the requests for the given host through transport, and the rest through
+//base
+type hostTransport struct {
+	base      http.RoundTripper
+	host      string
+	transport http.RoundTripper
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		return t.transport.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+//Cancels the requests when the webservice doesn't send anything for the given
+//seconds, either the response or the next chunk of its body, so that long
+//downloads are not interrupted while they make progress. The server errors
+//and the rejected credentials are returned as a ServerError or an
+//AuthenticationError wrapping the statusError
+type deadlineTransport struct {
+	base    http.RoundTripper
+	seconds int //no deadline if <= 0
+}
+
+func (t deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := newRequestDeadline(req.Context(), t.seconds)
+	resp, err := t.base.RoundTrip(req.WithContext(deadline.ctx))
+	if err != nil {
+		deadline.stop()
+		return nil, deadline.check(err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		message := errorMessage(deadlineBody{resp.Body, deadline})
+		resp.Body.Close()
+		deadline.stop()
+		//the query may carry the request signature
+		return nil, statusError{req.Method, req.URL.Path, resp.StatusCode, resp.Status, message}.typed()
+	}
+	resp.Body = deadlineBody{resp.Body, deadline}
+	return resp, nil
+}
+
+//Cancels the context of a request once it's idle for too long
+type requestDeadline struct {
+	ctx     context.Context
+	cancel  func()
+	timer   *time.Timer
+	seconds int
+	expired int32
+}
+
+func newRequestDeadline(parent context.Context, seconds int) *requestDeadline {
+	d := &requestDeadline{seconds: seconds}
+	d.ctx, d.cancel = context.WithCancel(parent)
+	if seconds > 0 {
+		d.timer = time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+			atomic.StoreInt32(&d.expired, 1)
+			d.cancel()
+		})
+	}
+	return d
+}
+
+//Gives the request the whole timeout again
+func (d *requestDeadline) extend() {
+	if d.timer != nil {
+		d.timer.Reset(time.Duration(d.seconds) * time.Second)
+	}
+}
+
+func (d *requestDeadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.cancel()
+}
+
+//Returns a timeoutError if the request failed because of the deadline
+func (d *requestDeadline) check(err error) error {
+	if atomic.LoadInt32(&d.expired) == 1 {
+		return timeoutError{d.seconds}
+	}
+	return err
+}
+
+//Response body that extends the deadline every time some data is received
+type deadlineBody struct {
+	io.ReadCloser
+	deadline *requestDeadline
+}
+
+func (b deadlineBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		return n, b.deadline.check(err)
+	}
+	b.deadline.extend()
+	return
+}
+
+func (b deadlineBody) Close() error {
+	b.deadline.stop()
+	return b.ReadCloser.Close()
+}
+
+//Wraps the access to the pipeline framework so that the idempotent calls once
+//the webservice is up (Job, Jobs, Log and Results) are retried with exponential
+//backoff when they fail because of a transient error. Alive is not retried, as
+//it's the way of finding out whether the webservice is up at all. The timeout is
+//applied to every request by the transport of the link (see SetTimeout)
+type retryPipeline struct {
+	PipelineApi
+	config    Config
+	baseUrl   string //webservice url, as given to the client library
+	key       string //credentials to sign the requests not sent by the client library
+	secret    string
+	transport http.RoundTripper //nil until the timeout is set
+}
+
+func newRetryPipeline(api PipelineApi, conf Config) *retryPipeline {
+	return &retryPipeline{PipelineApi: api, config: conf, baseUrl: conf.Url()}
+}
+
+func (p *retryPipeline) SetUrl(url string) {
+	p.baseUrl = url
+	p.PipelineApi.SetUrl(url)
+	if p.transport != nil {
+		routeWebservice(url, p.transport)
+	}
+}
+
+//Applies the timeout to the requests sent to the webservice
+func (p *retryPipeline) SetTimeout(seconds int) {
+	p.transport = newTimeoutTransport(seconds)
+	routeWebservice(p.baseUrl, p.transport)
+}
+
+//Returns the client for the requests not sent by the client library
+func (p retryPipeline) client() *http.Client {
+	if p.transport == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: p.transport}
+}
+
+func (p *retryPipeline) SetCredentials(key, secret string) {
+	p.key, p.secret = key, secret
+	p.PipelineApi.SetCredentials(key, secret)
+}
+
+//Returns the integer configuration value, or its default if it's not set
+func (p retryPipeline) intConfig(key string) int {
+	if val, ok := p.config[key].(int); ok {
+		return val
+	}
+	return config[key].(int)
+}
+
+//Calls fn until it succeeds, returns an error that is not retriable or runs out
+//of attempts. The delay between attempts is doubled every time
+func (p retryPipeline) retry(name string, fn func() error, retriable func(error) bool) (err error) {
+	delay := time.Duration(p.intConfig(RETRYDELAY)) * time.Millisecond
+	retries := p.intConfig(RETRIES)
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || attempt >= retries || !retriable(err) {
+			return
+		}
+		log.Printf("%v failed (%v), retrying in %v", name, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (p retryPipeline) Job(id string, msgSeq int) (job pipeline.Job, err error) {
+	err = p.retry("job", func() (err error) {
+		job, err = p.PipelineApi.Job(id, msgSeq)
+		return
+	}, isTransient)
+	return
+}
+
+func (p retryPipeline) Jobs() (jobs pipeline.Jobs, err error) {
+	err = p.retry("jobs", func() (err error) {
+		jobs, err = p.PipelineApi.Jobs()
+		return
+	}, isTransient)
+	return
+}
+
+func (p retryPipeline) Log(id string) (data []byte, err error) {
+	err = p.retry("log", func() (err error) {
+		data, err = p.PipelineApi.Log(id)
+		return
+	}, isTransient)
+	return
+}
+
+//The results are streamed, so the timeout only fires when no data is received
+//for too long, and the download is only retried if nothing was written yet
+func (p retryPipeline) Results(id string, w io.Writer) (ok bool, err error) {
+	counter := &countingWriter{Writer: w}
+	err = p.retry("results", func() (err error) {
+		ok, err = p.PipelineApi.Results(id, counter)
+		return
+	}, func(err error) bool {
+		return counter.written == 0 && isTransient(err)
+	})
+	return
+}
+
+//Resumes the download of the results from the given offset. The client
+//library can't send ranged requests, so they are sent here, signed as the
+//client library does when the webservice requires authentication. They go
+//through the transport of the link as well, so they get the same timeout
+func (p retryPipeline) ResultsFrom(id string, offset int64, w io.Writer) (ok bool, err error) {
+	counter := &countingWriter{Writer: w}
+	err = p.retry("results", func() (err error) {
+		ok, err = p.rangeResults(id, offset+counter.written, counter)
+		return
+	}, func(err error) bool {
+		return counter.written == 0 && isTransient(err)
+	})
+	return
+}
+
+//Gets the results of the job from the offset on
+func (p retryPipeline) rangeResults(id string, offset int64, w io.Writer) (ok bool, err error) {
+	resultsUrl := fmt.Sprintf("%vjobs/%v/result", p.baseUrl, url.PathEscape(id))
+	if p.key != "" {
+		resultsUrl = signUrl(resultsUrl, p.key, p.secret, time.Now(), newNonce())
+	}
+	req, err := http.NewRequest("GET", resultsUrl, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		_, err = io.Copy(w, resp.Body)
+	case http.StatusOK:
+		//ranges not supported, skip what we already have
+		_, err = io.Copy(&skipWriter{Writer: w, skip: offset}, resp.Body)
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, statusError{req.Method, req.URL.Path, resp.StatusCode, resp.Status, errorMessage(resp.Body)}
+	}
+	return err == nil, err
+}
+
+//Adds the authentication parameters to the url: the client id, the time, the
+//nonce and the HMAC-SHA1 signature of the url with them, keyed with the secret.
+//This is the scheme the webservice checks; the client library doesn't expose
+//its own signing, so it can't be shared with it
+func signUrl(rawUrl, key, secret string, now time.Time, nonce string) string {
+	sep := "?"
+	if strings.Contains(rawUrl, "?") {
+		sep = "&"
+	}
+	signed := fmt.Sprintf("%v%vauthid=%v&time=%v&nonce=%v", rawUrl, sep, url.QueryEscape(key), now.UTC().Format("2006-01-02T15:04:05Z"), nonce)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "&sign=" + url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+//Returns a random nonce for signing a request
+func newNonce() string {
+	nonce := make([]byte, 15)
+	rand.Read(nonce)
+	return fmt.Sprintf("%x", nonce)
+}
+
+//Counts the bytes written to the underlying writer, calling onWrite with the
+//total if it's set
+type countingWriter struct {
+	io.Writer
+	written int64
+	onWrite func(int64)
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.Writer.Write(p)
+	c.written += int64(n)
+	if c.onWrite != nil {
+		c.onWrite(c.written)
+	}
+	return
+}
+
+//Discards the first skip bytes written to it
+type skipWriter struct {
+	io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(p []byte) (n int, err error) {
+	if s.skip >= int64(len(p)) {
+		s.skip -= int64(len(p))
+		return len(p), nil
+	}
+	n, err = s.Writer.Write(p[s.skip:])
+	n += int(s.skip)
+	s.skip = 0
+	return
+}
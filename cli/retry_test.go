@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Pipeline mock whose calls fail a number of times before reaching the mock
+type flakyPipeline struct {
+	*PipelineTest
+	failures int    //number of calls that will fail
+	err      error  //error returned by the failing calls
+	written  []byte //written by Results before failing
+	calls    int
+}
+
+func (f *flakyPipeline) fail() bool {
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return true
+	}
+	return false
+}
+
+func (f *flakyPipeline) Job(id string, msgSeq int) (pipeline.Job, error) {
+	if f.fail() {
+		return pipeline.Job{}, f.err
+	}
+	return f.PipelineTest.Job(id, msgSeq)
+}
+
+func (f *flakyPipeline) Results(id string, w io.Writer) (bool, error) {
+	if f.fail() {
+		w.Write(f.written)
+		return false, f.err
+	}
+	return f.PipelineTest.Results(id, w)
+}
+
+func (f *flakyPipeline) Alive() (pipeline.Alive, error) {
+	if f.fail() {
+		return pipeline.Alive{}, f.err
+	}
+	return f.PipelineTest.Alive()
+}
+
+func retryConf(retries, timeout int) Config {
+	conf := copyConf()
+	conf[RETRIES] = retries
+	conf[RETRYDELAY] = 1
+	conf[TIMEOUT] = timeout
+	return conf
+}
+
+func TestRetryTransientError(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 2, err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	api := newRetryPipeline(flaky, retryConf(3, 10))
+	if _, err := api.Job("id", 0); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if flaky.calls != 3 {
+		t.Errorf("Wrong number of calls %v", flaky.calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 10, err: io.ErrUnexpectedEOF}
+	api := newRetryPipeline(flaky, retryConf(3, 10))
+	if _, err := api.Job("id", 0); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+	if flaky.calls != 4 {
+		t.Errorf("Wrong number of calls %v", flaky.calls)
+	}
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 1, err: errors.New("Job not found")}
+	api := newRetryPipeline(flaky, retryConf(3, 10))
+	if _, err := api.Job("id", 0); err == nil {
+		t.Errorf("Expected error")
+	}
+	if flaky.calls != 1 {
+		t.Errorf("Permanent errors shouldn't be retried (%v calls)", flaky.calls)
+	}
+}
+
+//Checks that Alive fails at once, so that finding out that the webservice is
+//down doesn't wait for the retries
+func TestAliveNotRetried(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 1, err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	api := newRetryPipeline(flaky, retryConf(3, 10))
+	if _, err := api.Alive(); err == nil {
+		t.Errorf("Expected error")
+	}
+	if flaky.calls != 1 {
+		t.Errorf("Alive shouldn't be retried (%v calls)", flaky.calls)
+	}
+}
+
+func TestRetryResults(t *testing.T) {
+	flaky := &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 1, err: io.EOF}
+	api := newRetryPipeline(flaky, retryConf(3, 10))
+	if _, err := api.Results("id", ioutil.Discard); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("Wrong number of calls %v", flaky.calls)
+	}
+	//partial downloads are not retried
+	flaky = &flakyPipeline{PipelineTest: newPipelineTest(false), failures: 1, err: io.EOF, written: []byte("PK")}
+	api = newRetryPipeline(flaky, retryConf(3, 10))
+	var buf bytes.Buffer
+	if _, err := api.Results("id", &buf); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Errorf("A partial download was retried")
+	}
+}
+
+//Checks that the requests are cancelled when the webservice doesn't answer
+func TestDeadlineTransportTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	client := &http.Client{Transport: deadlineTransport{base: &http.Transport{}, seconds: 1}}
+	start := time.Now()
+	_, err := client.Get(server.URL)
+	var timeout timeoutError
+	if !errors.As(err, &timeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if !isTransient(err) {
+		t.Errorf("Timeouts should be transient")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("The request wasn't cancelled in time")
+	}
+}
+
+//Checks that slow downloads that make progress are not interrupted
+func TestDeadlineTransportSlowBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			io.WriteString(w, "data")
+			w.(http.Flusher).Flush()
+			time.Sleep(400 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: deadlineTransport{base: &http.Transport{}, seconds: 1}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil || string(data) != "datadatadatadata" {
+		t.Errorf("Unexpected result %q %v", data, err)
+	}
+}
+
+//Checks that the server errors and the rejected credentials are typed
+func TestDeadlineTransportStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/failed":
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<error xmlns="http://www.daisy.org/ns/pipeline/data"><description>Script not found</description><trace>...</trace></error>`)
+		case "/denied":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: deadlineTransport{base: &http.Transport{}}}
+	_, err := client.Get(server.URL + "/busy?sign=secret")
+	var status statusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusServiceUnavailable || !isTransient(err) {
+		t.Errorf("Expected a transient status error, got %v", err)
+	}
+	if strings.Contains(status.Error(), "secret") {
+		t.Errorf("The query shouldn't be part of the message %v", status)
+	}
+	_, err = client.Get(server.URL + "/failed")
+	if !errors.As(err, &status) || status.Message != "Script not found" || !strings.Contains(err.Error(), "Script not found") {
+		t.Errorf("The message of the webservice was lost %v", err)
+	}
+	_, err = client.Get(server.URL + "/denied")
+	if !errors.As(err, &status) || status.StatusCode != http.StatusUnauthorized || isTransient(err) {
+		t.Errorf("Expected a permanent status error, got %v", err)
+	}
+	resp, err := client.Get(server.URL + "/other")
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Other statuses are left to the client library %v %v", resp, err)
+	}
+}
+
+//Checks that only the requests for the webservice go through the link's
+//transport and that the default transport is left as it was
+func TestRouteWebservice(t *testing.T) {
+	defer func() { http.DefaultTransport = defaultTransport }()
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	ws := httptest.NewServer(handler)
+	defer ws.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+	defer close(release)
+	api := newRetryPipeline(newPipelineTest(false), retryConf(0, 1))
+	api.SetUrl(ws.URL + "/ws/")
+	dial := defaultTransport.(*http.Transport).DialContext
+	api.SetTimeout(1)
+	if reflect.ValueOf(defaultTransport.(*http.Transport).DialContext).Pointer() != reflect.ValueOf(dial).Pointer() {
+		t.Errorf("The default transport was modified")
+	}
+	var timeout timeoutError
+	if _, err := http.Get(ws.URL); !errors.As(err, &timeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := http.Get(other.URL)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Errorf("The timeout was applied to other hosts %v", err)
+	case <-time.After(2 * time.Second):
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	transient := []error{
+		io.EOF,
+		timeoutError{1},
+		&url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}},
+		&url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs", Err: statusError{"GET", "/ws/jobs", 503, "503 Service Unavailable", ""}},
+	}
+	for _, err := range transient {
+		if !isTransient(err) {
+			t.Errorf("%v should be transient", err)
+		}
+	}
+	permanent := []error{
+		errors.New("Job not found"),
+		errors.New("Job 3f5020eb-timeout-504 not found"),
+		errors.New("Cannot read thereof.xml"),
+		statusError{"GET", "/ws/jobs", 500, "500 Internal Server Error", ""},
+	}
+	for _, err := range permanent {
+		if isTransient(err) {
+			t.Errorf("%v shouldn't be transient", err)
+		}
+	}
+}
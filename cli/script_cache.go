@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	SCRIPT_CACHE_FILE = "scripts.json" //Name of the script list cache, stored next to the last id file
+)
+
+//Path to the script list cache, an empty path disables the cache
+var ScriptCachePath = filepath.Join(filepath.Dir(LastIdPath), SCRIPT_CACHE_FILE)
+
+//List of scripts offered by a webservice
+type scriptCache struct {
+	Url     string            //Webservice url
+	Version string            //Framework version
+	Scripts []pipeline.Script //Script summaries, without inputs nor options
+}
+
+//Returns true if the cache was stored for the given webservice and framework version
+func (c scriptCache) validFor(url, version string) bool {
+	return c.Url == url && c.Version == version
+}
+
+//Reads the script list cache
+func loadScriptCache(path string) (cache scriptCache, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cache)
+	return
+}
+
+//Writes the script list cache
+func storeScriptCache(path string, cache scriptCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+//Returns the list of scripts available in the framework. The scripts only contain
+//their summary (id, description, version...), use Script to get the inputs and
+//options. The list is read from the cache unless refresh is set or the cache
+//belongs to a different webservice or framework version
+func (p PipelineLink) ScriptList(refresh bool) (scripts []pipeline.Script, err error) {
+	url := p.config.Url()
+	if !refresh && ScriptCachePath != "" {
+		if cache, err := loadScriptCache(ScriptCachePath); err == nil && cache.validFor(url, p.Version) {
+			log.Println("Using the cached script list")
+			return cache.Scripts, nil
+		}
+	}
+	scriptsStruct, err := p.pipeline.Scripts()
+	if err != nil {
+		return
+	}
+	scripts = make([]pipeline.Script, len(scriptsStruct.Scripts))
+	for idx, script := range scriptsStruct.Scripts {
+		scripts[idx] = pipeline.Script{
+			Id:          script.Id,
+			Href:        script.Href,
+			Nicename:    script.Nicename,
+			Description: script.Description,
+			Version:     script.Version,
+		}
+	}
+	if ScriptCachePath != "" {
+		if err := storeScriptCache(ScriptCachePath, scriptCache{url, p.Version, scripts}); err != nil {
+			log.Printf("Error storing the script list cache: %v", err)
+		}
+	}
+	return scripts, nil
+}
+
+//Gets the full definition of the script
+func (p PipelineLink) Script(id string) (script pipeline.Script, err error) {
+	return p.pipeline.Script(id)
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func withScriptCache() func() {
+	old := ScriptCachePath
+	ScriptCachePath = filepath.Join(os.TempDir(), "testScriptCache.json")
+	os.Remove(ScriptCachePath)
+	return func() {
+		os.Remove(ScriptCachePath)
+		ScriptCachePath = old
+	}
+}
+
+func TestScriptListCache(t *testing.T) {
+	defer withScriptCache()()
+	link := PipelineLink{pipeline: newPipelineTest(false), config: config, Version: "1.0"}
+	scripts, err := link.ScriptList(false)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(scripts) != 1 || scripts[0].Id != "test" {
+		t.Errorf("Wrong script list %v", scripts)
+	}
+	if getCall(link) != SCRIPTS_CALL {
+		t.Errorf("The script list wasn't requested to the webservice")
+	}
+
+	link.pipeline.(*PipelineTest).call = ""
+	scripts, err = link.ScriptList(false)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if getCall(link) != "" {
+		t.Errorf("The cached script list wasn't used")
+	}
+	if len(scripts) != 1 || scripts[0].Id != "test" {
+		t.Errorf("Wrong cached script list %v", scripts)
+	}
+}
+
+func TestScriptListCacheInvalidation(t *testing.T) {
+	defer withScriptCache()()
+	link := PipelineLink{pipeline: newPipelineTest(false), config: config, Version: "1.0"}
+	if _, err := link.ScriptList(false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//refresh
+	link.pipeline.(*PipelineTest).call = ""
+	if _, err := link.ScriptList(true); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if getCall(link) != SCRIPTS_CALL {
+		t.Errorf("The cache wasn't refreshed")
+	}
+	//new framework version
+	link.Version = "1.1"
+	link.pipeline.(*PipelineTest).call = ""
+	if _, err := link.ScriptList(false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if getCall(link) != SCRIPTS_CALL {
+		t.Errorf("The cache wasn't invalidated by the version change")
+	}
+	cache, err := loadScriptCache(ScriptCachePath)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !cache.validFor(config.Url(), "1.1") {
+		t.Errorf("The cache wasn't updated %v", cache)
+	}
+}
+
+func TestLazyScriptHelp(t *testing.T) {
+	config[STARTING] = false
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false), config: config}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli.AddLazyScripts([]pipeline.Script{pipeline.Script{Id: "test", Description: "Mocked script"}}, link)
+	cmd := cli.Parser.Commands["test"]
+	if len(cmd.Flags()) != 0 {
+		t.Errorf("The script flags were loaded eagerly")
+	}
+	if getCall(*link) == SCRIPT_CALL {
+		t.Errorf("The script definition was requested before it was needed")
+	}
+	if err := printHelp(*cli, false, false, false, "test"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if getCall(*link) != SCRIPT_CALL {
+		t.Errorf("The script definition wasn't requested")
+	}
+	found := false
+	for _, flag := range cmd.Flags() {
+		found = found || flag.Long == "test-opt"
+	}
+	if !found {
+		t.Errorf("test-opt option not found after loading the script")
+	}
+}
+
+func TestLazyScriptDataOption(t *testing.T) {
+	config[STARTING] = false
+	link := &PipelineLink{FsAllow: false, pipeline: newPipelineTest(false), config: config}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli.AddLazyScripts([]pipeline.Script{pipeline.Script{Id: "test"}}, link)
+	script := cli.Scripts[0]
+	script.addDataOption()
+	if len(script.Flags()) != 0 {
+		t.Errorf("The data option was added before the script flags")
+	}
+	if err := script.load(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	flags := script.Flags()
+	if len(flags) == 0 || flags[len(flags)-1].Long != "data" {
+		t.Errorf("The data option should be the last one")
+	}
+}
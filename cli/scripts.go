@@ -12,6 +12,8 @@ import (
 	"strings"
 	"regexp"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/capitancambio/blackterm"
 	"github.com/capitancambio/chalk"
@@ -24,20 +26,24 @@ var LastIdPath = getLastIdPath(runtime.GOOS)
 
 //Represents the job request
 type JobRequest struct {
-	Script     string               //Script id to call
-	Nicename   string               //Job's nicename
-	Priority   string               //Job's priority
-	Options    map[string][]string  //Options for the script
-	Inputs     map[string][]url.URL //Input ports for the script
-	Data       []byte               //Data to send with the job request
-	Background bool                 //Send the request and return
+	Script      string               //Script id to call
+	Nicename    string               //Job's nicename
+	Priority    string               //Job's priority
+	Options     map[string][]string  //Options for the script
+	Inputs      map[string][]url.URL //Input ports for the script
+	Data        []byte               //Data to send with the job request
+	Background  bool                 //Send the request and return
+	Batch       map[string]string    //Input ports given as a set of files (glob, directory or @list)
+	FileOptions map[string]bool      //Options whose values are files or directories
 }
 
 //Creates a new JobRequest
 func newJobRequest() *JobRequest {
 	return &JobRequest{
-		Options: make(map[string][]string),
-		Inputs:  make(map[string][]url.URL),
+		Options:     make(map[string][]string),
+		Inputs:      make(map[string][]url.URL),
+		Batch:       make(map[string]string),
+		FileOptions: make(map[string]bool),
 	}
 }
 
@@ -51,6 +57,43 @@ func (c *Cli) AddScripts(scripts []pipeline.Script, link *PipelineLink) error {
 	return nil
 }
 
+//Adds several scripts to a client from their summaries. The inputs and options of
+//every script are only loaded when its command is called or its help is displayed
+func (c *Cli) AddLazyScripts(scripts []pipeline.Script, link *PipelineLink) error {
+	for _, s := range scripts {
+		id := s.Id
+		definition := func() (pipeline.Script, error) {
+			return link.Script(id)
+		}
+		if _, err := newScriptCommand(s, c, link, definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	DryRunTemplate = `Script:		{{.Script}}
+Nicename:	{{.Nicename}}
+Priority:	{{.Priority}}
+Inputs:{{range $name, $values := .Inputs}}
+	{{$name}}:	{{range $idx, $value := $values}}{{if $idx}}, {{end}}{{$value}}{{end}}{{end}}
+Options:{{range $name, $values := .Options}}
+	{{$name}}:	{{range $idx, $value := $values}}{{if $idx}}, {{end}}{{$value}}{{end}}{{end}}
+Data:		{{.DataSize}} bytes
+`
+)
+
+//Request as printed by --dry-run
+type dryRunSummary struct {
+	Script   string
+	Nicename string
+	Priority string
+	Inputs   map[string][]string
+	Options  map[string][]string
+	DataSize int
+}
+
 //Executes a job request
 type jobExecution struct {
 	link       *PipelineLink
@@ -59,13 +102,71 @@ type jobExecution struct {
 	verbose    bool
 	persistent bool
 	zipped     bool
+	policy     existsPolicy //what to do with the existing result files
+	settings   *jobTemplate //flags given, saved with --save-template
+	saveAs     string       //name of the template to save
+	dryRun     bool         //check and print the request without sending it
+	messages   messageFilter
+	report     bool //summarise the validation reports in the results
 }
 
+//Runs the job, jobs finishing with status FAIL or ERROR are reported as a
+//JobError
 func (j jobExecution) run(stdOut io.Writer) error {
+	job, status, err := j.execute(stdOut)
+	if err == nil && (status == "FAIL" || status == "ERROR") {
+		return JobError{[]string{job.Id}, status}
+	}
+	return err
+}
+
+//Gets the request ready to be sent. Remote webservices need the local files
+//in the data zip, so they are packaged (or checked against the zip given by
+//the user)
+func (j jobExecution) prepare() error {
+	if !j.link.IsLocal() {
+		return packageData(j.req, j.link.maxDataSize())
+	}
+	return nil
+}
+
+//Prints the request that would be sent once it's been checked and prepared
+func (j jobExecution) dryRunReport(cli *Cli) error {
+	if err := j.prepare(); err != nil {
+		return err
+	}
+	pReq, err := jobRequestToPipeline(*j.req, *j.link)
+	if err != nil {
+		return err
+	}
+	summary := dryRunSummary{
+		Script:   pReq.Script.Href,
+		Nicename: j.req.Nicename,
+		Priority: j.req.Priority,
+		Inputs:   map[string][]string{},
+		Options:  map[string][]string{},
+		DataSize: len(j.req.Data),
+	}
+	doc := newJobRequestDoc(pReq)
+	for _, input := range doc.Inputs {
+		summary.Inputs[input.Name] = input.values()
+	}
+	for _, option := range doc.Options {
+		summary.Options[option.Name] = option.values()
+	}
+	return commandBuilder{template: DryRunTemplate}.writeOutput(summary, cli)
+}
+
+//Sends the job, follows its execution and fetches its results. Returns the job
+//and the status in which it finished
+func (j jobExecution) execute(stdOut io.Writer) (job pipeline.Job, status string, err error) {
 	log.Printf("run data len %v\n", len(j.req.Data))
 	//manual check of output
 	if !j.req.Background && j.output == "" {
-		return errors.New("--output option is mandatory if the job is not running in the req.Background")
+		return job, status, errors.New("--output option is mandatory if the job is not running in the req.Background")
+	}
+	if err = j.prepare(); err != nil {
+		return
 	}
 	if j.req.Background && j.output != "" {
 		fmt.Printf("Warning: --output option ignored as the job will run in the background\n")
@@ -74,59 +175,46 @@ func (j jobExecution) run(stdOut io.Writer) error {
 	//send the job
 	job, messages, err := j.link.Execute(*(j.req))
 	if err != nil {
-		return err
+		return
 	}
 	fmt.Fprintf(stdOut, "Job %v sent to the server\n", job.Id)
 	//store id if it suits
 	if storeId {
 		err = storeLastId(job.Id)
 		if err != nil {
-			return err
+			return
 		}
 	}
 	//get realtime messages, status and progress from the webservice
-	status := job.Status
-	progress := 0.0
-	printProgressBar(stdOut, progress)
-	for msg := range messages {
-		if msg.Error != nil {
-			err = msg.Error
-			return err
-		}
-		if j.verbose && msg.Message != "" || msg.Progress > progress {
-			//erase the progress bar (last two lines)
-			//FIXME: don't do this when debug logging enabled
-			fmt.Fprint(stdOut, "\n\033[1A\033[K\033[1A\033[K")
-			if j.verbose && msg.Message != "" {
-				fmt.Fprintf(stdOut, "%v\n", msg.String())
-			}
-			if (msg.Progress > progress) {
-				progress = msg.Progress
-			}
-			printProgressBar(stdOut, progress)
-		}
-		status = msg.Status
+	status, err = printMessages(stdOut, messages, j.verbose, j.messages, true, nil, nil)
+	if err != nil {
+		return
+	}
+	if status == "" {
+		status = job.Status
 	}
 
 	if status != "ERROR" {
 		//get the data
 		if !j.req.Background {
-			wc, err := zipProcessor(j.output, j.zipped)
+			var wc io.WriteCloser
+			wc, err = zipProcessor(j.output, j.zipped, j.policy)
 			if err != nil {
-				return err
+				return
 			}
-			ok, err := j.link.Results(job.Id, wc)
+			var ok bool
+			ok, err = j.link.DownloadResults(job.Id, wc, progressOutput())
 			if err != nil {
-				return err
+				return
 			}
-			if err := wc.Close(); err != nil {
-				return err
+			if err = wc.Close(); err != nil {
+				return
 			}
 			fmt.Fprintln(stdOut)
 			if !j.persistent {
 				_, err = j.link.Delete(job.Id)
 				if err != nil {
-					return err
+					return
 				}
 				fmt.Fprintf(stdOut, "The job has been deleted from the server\n")
 			}
@@ -134,12 +222,89 @@ func (j jobExecution) run(stdOut io.Writer) error {
 			if (!ok && (status == "SUCCESS" || status == "FAIL")) {
 				fmt.Fprintf(stdOut, "No results available\n")
 			}
+			if j.report {
+				err = j.summariseReports(stdOut, wc)
+			}
 		}
 
+	} else if j.report && !j.req.Background {
+		fmt.Fprintf(stdOut, "No validation report as the job finished with status ERROR\n")
+	}
+	return
+}
+
+//Prints the summary of the validation reports among the results written to
+//the output by wc. Returns an exit error if the validation failed
+func (j jobExecution) summariseReports(stdOut io.Writer, wc io.WriteCloser) error {
+	var summary *validationSummary
+	var err error
+	switch w := wc.(type) {
+	case *ZipInflator:
+		summary, err = readValidationReports(j.output, w.written)
+	case *os.File:
+		summary, err = readZippedValidationReports(j.output)
+	default:
+		//the existing zip file was kept
+		fmt.Fprintf(stdOut, "No validation report as the results weren't written to %v\n", j.output)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	summary.print(stdOut)
+	if n := summary.Counts["error"]; n > 0 {
+		return ExitError{EXIT_INVALID, fmt.Sprintf("The validation found %d %v", n, plural("error", n))}
+	} else if summary.failed() {
+		return ExitError{EXIT_INVALID, "The validation failed"}
 	}
 	return nil
 }
 
+//Consumes the job messages printing them (if verbose and selected by the
+//filter) and the progress bar (if progressBar). Returns the status of the job
+//once the channel is closed. If the timeout channel fires or detach is closed
+//before, the last known status is returned along with errTimeout or errDetached
+func printMessages(stdOut io.Writer, messages chan Message, verbose bool, filter messageFilter, progressBar bool, timeout <-chan time.Time, detach <-chan struct{}) (status string, err error) {
+	progress := 0.0
+	color := isTerminal(stdOut)
+	if progressBar {
+		printProgressBar(stdOut, progress)
+	}
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return status, nil
+			}
+			if msg.Error != nil {
+				return status, msg.Error
+			}
+			show := verbose && msg.Message != "" && filter.accepts(msg)
+			if progressBar && (show || msg.Progress > progress) {
+				//erase the progress bar (last two lines)
+				//FIXME: don't do this when debug logging enabled
+				fmt.Fprint(stdOut, "\n\033[1A\033[K\033[1A\033[K")
+				if show {
+					fmt.Fprintf(stdOut, "%v\n", msg.format(color))
+				}
+				if msg.Progress > progress {
+					progress = msg.Progress
+				}
+				printProgressBar(stdOut, progress)
+			} else if show {
+				fmt.Fprintf(stdOut, "%v\n", msg.format(color))
+			}
+			if msg.Status != "" {
+				status = msg.Status
+			}
+		case <-timeout:
+			return status, errTimeout
+		case <-detach:
+			return status, errDetached
+		}
+	}
+}
+
 func printProgressBar(stdOut io.Writer, value float64) {
 	line := ""
 	for len(line) < 78 {
@@ -155,7 +320,7 @@ func printProgressBar(stdOut io.Writer, value float64) {
 	fmt.Fprintf(stdOut, "%v\n%v %.1f%% ", line, bar, value * 100)
 }
 
-var commonFlags = []string{"--output", "--zip", "--nicename", "--priority", "--quiet", "--persistent", "--background"}
+var commonFlags = []string{"--output", "--zip", "--overwrite", "--skip-existing", "--fail-if-exists", "--save-template", "--dump-request", "--dry-run", "--report", "--nicename", "--priority", "--quiet", "--level", "--depth", "--persistent", "--background", "--batch", "--parallel"}
 
 func getFlagName(name, prefix string, flags []subcommand.Flag) string {
 	flaggedName := "--" + name
@@ -175,29 +340,86 @@ func getFlagName(name, prefix string, flags []subcommand.Flag) string {
 func flagsToString(flags []subcommand.Flag) []string {
 	res := make([]string, len(flags), len(flags))
 	for idx, flag := range flags {
-		res[idx] = flag.Long
+		res[idx] = "--" + flag.Long
 	}
 	return res
 }
 
+//Returns the flag names of the script inputs and options, prefixed with i- or
+//x- when they clash with a common flag or with a previous input or option
+func scriptFlagNames(script pipeline.Script) (inputs, options map[string]string) {
+	inputs, options = map[string]string{}, map[string]string{}
+	flags := []subcommand.Flag{}
+	for _, input := range script.Inputs {
+		inputs[input.Name] = getFlagName(input.Name, "i-", flags)
+		flags = append(flags, subcommand.Flag{Long: inputs[input.Name]})
+	}
+	for _, option := range script.Options {
+		options[option.Name] = getFlagName(option.Name, "x-", flags)
+		flags = append(flags, subcommand.Flag{Long: options[option.Name]})
+	}
+	return
+}
+
 //Adds the command and flags to be able to call the script to the cli
 func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req *JobRequest, err error) {
+	return newScriptCommand(script, cli, link, nil)
+}
+
+//Adds the script command to the cli. When definition is not nil the inputs and
+//options are taken from the script it returns once the command is actually used,
+//otherwise they are taken from script straight away
+func newScriptCommand(script pipeline.Script, cli *Cli, link *PipelineLink, definition func() (pipeline.Script, error)) (req *JobRequest, err error) {
 	jobRequest := newJobRequest()
 	jobRequest.Script = script.Id
 	jobRequest.Background = false
 	jExec := jobExecution{
-		link:    link,
-		req:     jobRequest,
-		output:  "",
-		verbose: true,
-		zipped:  false,
+		link:     link,
+		req:      jobRequest,
+		output:   "",
+		verbose:  true,
+		zipped:   false,
+		settings: newJobTemplate(script.Id),
 	}
+	batch := false
+	dump := false
+	parallel := DEFAULT_PARALLEL
 	desc := blackterm.MarkdownString(script.Description)
-	command := cli.AddScriptCommand(
+	command := cli.addScriptCommand(
 		script.Id,
 		desc,
 		fmt.Sprintf("%s [v%s]", desc, script.Version),
 		func(string, ...string) error {
+			if dump {
+				if batch {
+					return errors.New("--dump-request can't be used in batch mode")
+				}
+				return cli.dumpRequest(*jobRequest, *link)
+			}
+			if jExec.saveAs != "" {
+				path, err := saveTemplate(jExec.saveAs, *jExec.settings)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cli.Output, "Template %v saved to %v\n", jExec.saveAs, path)
+			}
+			if jExec.report && (batch || jobRequest.Background) {
+				return errors.New("--report can't be used in batch mode or in the background")
+			}
+			if jExec.dryRun {
+				if batch {
+					return errors.New("--dry-run can't be used in batch mode")
+				}
+				return jExec.dryRunReport(cli)
+			}
+			if batch {
+				return batchExecution{jExec, parallel}.run(cli.Output)
+			}
+			for name, spec := range jobRequest.Batch {
+				if len(jobRequest.Inputs[name]) == 0 {
+					return fmt.Errorf("--%v %v: not a file, use --batch to run the script once per file", name, spec)
+				}
+			}
 			if err := jExec.run(cli.Output); err != nil {
 				return err
 			}
@@ -206,9 +428,28 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 		jobRequest,
 	)
 	command.SetArity(0, "")
+	if definition != nil {
+		command.loader = func() error {
+			full, err := definition()
+			if err != nil {
+				return fmt.Errorf("Error loading script %v: %v", script.Id, err)
+			}
+			addScriptFlags(command, full, &jExec, &batch, &dump, &parallel)
+			return nil
+		}
+		command.PreFlags(command.load)
+		return jobRequest, nil
+	}
+	addScriptFlags(command, script, &jExec, &batch, &dump, &parallel)
+	return jobRequest, nil
+}
 
+//Adds the flags for the script inputs and options and the common flags to the command
+func addScriptFlags(command *ScriptCommand, script pipeline.Script, jExec *jobExecution, batch, dump *bool, parallel *int) {
+	jobRequest, link, settings := jExec.req, jExec.link, jExec.settings
+	inputNames, optionNames := scriptFlagNames(script)
 	for _, input := range script.Inputs {
-		name := getFlagName(input.Name, "i-", command.Flags())
+		name := inputNames[input.Name]
 		shortDesc := input.ShortDesc
 		longDesc := input.LongDesc
 		// FIXME: assumes markdown without html
@@ -221,12 +462,14 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 		if (shortDesc == "") {
 			shortDesc = input.NiceName
 		}
-		command.AddOption(name, "", shortDesc, longDesc, italic("FILE"), inputFunc(jobRequest, link)).Must(input.Required)
+		flag := command.AddOption(name, "", shortDesc, longDesc, italic("FILE"), inputFunc(jobRequest, link, input.Sequence))
+		flag.Must(input.Required)
+		flag.SetCompletion(subcommand.Completion{Kind: subcommand.CompleteFiles})
 	}
 
 	for _, option := range script.Options {
 		//desc:=option.Desc+
-		name := getFlagName(option.Name, "x-", command.Flags())
+		name := optionNames[option.Name]
 		shortDesc := option.ShortDesc
 		longDesc := option.LongDesc
 		longDesc += ("\n\nPossible values: " + optionTypeToDetailedHelp(option.Type))
@@ -248,25 +491,59 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 		if (shortDesc == "") {
 			shortDesc = option.NiceName
 		}
-		command.AddOption(
+		flag := command.AddOption(
 			name, "", shortDesc, longDesc, optionTypeToString(option.Type, name, option.Default),
-			optionFunc(jobRequest, link, option.Type, option.Sequence)).Must(option.Required)
+			settings.option(optionFunc(jobRequest, link, option.Type, option.Sequence)))
+		flag.Must(option.Required)
+		flag.SetCompletion(optionCompletion(option.Type))
 	}
-	command.AddOption("output", "o", "Path where to store the results. This option is mandatory when the job is not executed in the background", "", italic("DIRECTORY"), func(name, folder string) error {
-		jExec.output = folder
+	addJobFlags(command.Command, jExec)
+	command.AddSwitch("batch", "", "Runs one job per file of the input given as a glob, a directory or an @list of files", settings.switchFn(func(string, string) error {
+		*batch = true
+		return nil
+	}))
+	command.AddOption("parallel", "", fmt.Sprintf("Number of jobs sent at the same time in batch mode (default %v)", DEFAULT_PARALLEL), "", italic("JOBS"), settings.option(func(name, value string) (err error) {
+		*parallel, err = strconv.Atoi(value)
+		if err != nil || *parallel < 1 {
+			return fmt.Errorf("--parallel must be a positive number (found %v)", value)
+		}
+		return nil
+	}))
+	command.AddSwitch("dry-run", "", "Checks the inputs and options and prints the job request without sending it", func(string, string) error {
+		jExec.dryRun = true
 		return nil
 	})
-	command.AddSwitch("zip", "z", "Write the output to a zip file rather than to a folder", func(string, string) error {
-		jExec.zipped = true
+	command.AddSwitch("dump-request", "", "Prints the job request, in xml or json if that's the selected format, instead of sending it", func(string, string) error {
+		*dump = true
+		return nil
+	})
+	command.AddOption("save-template", "", "Saves the flags given, but the inputs, as a template to be used with run NAME", "", italic("NAME"), func(name, value string) error {
+		jExec.saveAs = value
 		return nil
 	})
+}
 
-	command.AddOption("nicename", "n", "Set job's nice name", "", italic("NICENAME"), func(name, nice string) error {
+//Adds the flags that control how the job is sent and followed, shared by the
+//script commands and submit. The values are recorded in jExec.settings when
+//it's not nil
+func addJobFlags(cmd *subcommand.Command, jExec *jobExecution) {
+	settings := jExec.settings
+	cmd.AddOption("output", "o", "Path where to store the results. This option is mandatory when the job is not executed in the background", "", italic("DIRECTORY"), settings.option(func(name, folder string) error {
+		jExec.output = folder
+		return nil
+	})).SetCompletion(subcommand.Completion{Kind: subcommand.CompleteDirs})
+	cmd.AddSwitch("zip", "z", "Write the output to a zip file rather than to a folder", settings.switchFn(func(string, string) error {
+		jExec.zipped = true
+		return nil
+	}))
+	addExistsPolicySwitches(cmd, &jExec.policy, settings)
+
+	cmd.AddOption("nicename", "n", "Set job's nice name", "", italic("NICENAME"), settings.option(func(name, nice string) error {
 		jExec.req.Nicename = nice
 
 		return nil
-	})
-	command.AddOption("priority", "r", "Set job's priority", "", "(high|" + underline("medium") + "|low)", func(name, priority string) error {
+	}))
+	cmd.AddOption("priority", "r", "Set job's priority", "", "(high|" + underline("medium") + "|low)", settings.option(func(name, priority string) error {
 		if checkPriority(priority) {
 			jExec.req.Priority = priority
 			return nil
@@ -274,22 +551,25 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 			return fmt.Errorf("%s is not a valid priority. Allowed values are high, medium and low",
 				priority)
 		}
-	})
-	command.AddSwitch("quiet", "q", "Do not print the job's messages", func(string, string) error {
+	})).SetCompletion(subcommand.Completion{Values: []string{"high", "medium", "low"}})
+	cmd.AddSwitch("quiet", "q", "Do not print the job's messages", settings.switchFn(func(string, string) error {
 		jExec.verbose = false
 		return nil
-	})
-	command.AddSwitch("persistent", "p", "Do not delete the job after it is executed", func(string, string) error {
+	}))
+	jExec.messages.addFlags(cmd, settings.option)
+	cmd.AddSwitch("persistent", "p", "Do not delete the job after it is executed", settings.switchFn(func(string, string) error {
 		jExec.persistent = true
 		return nil
-	})
+	}))
 
-	command.AddSwitch("background", "b", "Sends the job and exits", func(string, string) error {
+	cmd.AddSwitch("background", "b", "Sends the job and exits", settings.switchFn(func(string, string) error {
 		jExec.req.Background = true
 		return nil
-	})
-
-	return jobRequest, nil
+	}))
+	cmd.AddSwitch("report", "", "Prints a summary of the validation reports in the results, the exit code is not zero if they have errors", settings.switchFn(func(string, string) error {
+		jExec.report = true
+		return nil
+	}))
 }
 
 func optionTypeToString(optionType pipeline.DataType, optionName string, defaultValue string) string {
@@ -418,50 +698,117 @@ func optionTypeToDetailedHelp(optionType pipeline.DataType) string {
 	return help
 }
 
+//Adds the flags of a script command loaded lazily, if they are not there yet
+func (c *ScriptCommand) load() error {
+	if c.loader == nil {
+		return nil
+	}
+	loader := c.loader
+	c.loader = nil
+	return loader()
+}
+
+//Adds the data option to the command. For lazily loaded scripts the option is
+//added after the script flags, once they are loaded
 func (c *ScriptCommand) addDataOption() {
-	c.AddOption("data", "d", "Zip file containing the files to convert", "", "", func(name, path string) error {
-		file, err := os.Open(path)
-		defer func() {
-			err := file.Close()
-			if err != nil {
-				log.Printf("Error closing file %v :%v", path, err.Error())
+	if c.loader != nil {
+		loader := c.loader
+		c.loader = func() error {
+			if err := loader(); err != nil {
+				return err
 			}
-		}()
-		if err != nil {
-			return err
+			c.addDataOption()
+			return nil
 		}
-		c.req.Data, err = ioutil.ReadAll(file)
-		//FIXME: this breaks the tests, but focused in a different thing right now
-		//if err != nil {
-		//return err
-		//}
-		log.Printf("data len %v\n", len(c.req.Data))
-		return nil
-	}).Must(true)
+		return
+	}
+	addDataFlag(c.Command, c.req)
+}
+
+//Adds the option to give the data zip of the request
+func addDataFlag(cmd *subcommand.Command, req *JobRequest) {
+	cmd.AddOption("data", "d", "Zip file containing the files to convert. If not given, the local files referenced by the inputs and options are packaged automatically", "", "", func(name, path string) error {
+		return req.readData(path)
+	}).SetCompletion(subcommand.Completion{Kind: subcommand.CompleteFiles})
+}
+
+//Reads the data zip of the request. The inputs may be given after it, so they
+//are checked against the zip before sending the job
+func (r *JobRequest) readData(path string) (err error) {
+	if r.Data, err = ioutil.ReadFile(path); err != nil {
+		return err
+	}
+	if _, err = dataEntries(r.Data); err != nil {
+		return fmt.Errorf("--data %v: %v", path, err)
+	}
+	log.Printf("data len %v\n", len(r.Data))
+	return nil
+}
+
+//Splits the value of an input or option into the values of a sequence. The
+//values are separated by commas, \, stands for a literal comma. If the value
+//is the name of an existing file it's taken as is, so that file names with
+//commas don't need escaping
+func splitValues(value string) []string {
+	if _, err := os.Stat(value); err == nil {
+		return []string{value}
+	}
+	values := []string{}
+	current := ""
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			current += ","
+			i++
+		case value[i] == ',':
+			values = append(values, current)
+			current = ""
+		default:
+			current += string(value[i])
+		}
+	}
+	return append(values, current)
 }
 
 //Returns a function that fills the request info with the subcommand option name
-//and value
-func inputFunc(req *JobRequest, link *PipelineLink) func(string, string) error {
-	return func(name, value string) (err error) {
+//and value. Sequence ports accept several files, either separated by commas or
+//repeating the option, while single ports reject more than one
+func inputFunc(req *JobRequest, link *PipelineLink, sequence bool) func(string, string) error {
+	return func(name, value string) error {
 		//control prefix
 		basePath := getBasePath(link.IsLocal())
 		if strings.HasPrefix("i-", name) {
 			name = name[2:]
 		}
-		// FIXME: check if input is a sequence
-		for _, path := range strings.Split(value, ",") {
-			var u *url.URL
-			u, err = pathToUri(path, basePath)
-			if err != nil {
-				return
-			}
-			req.Inputs[name] = append(req.Inputs[name], *u)
+		//sets of files are kept to be expanded in batch mode, without
+		//--batch the value is taken as a file if possible
+		if isBatchSpec(value) {
+			req.Batch[name] = value
+			addInputValues(req, name, value, basePath, sequence)
+			return nil
 		}
-		return
+		return addInputValues(req, name, value, basePath, sequence)
 	}
 }
 
+//Adds the files in value to the input port, none if any of them is wrong
+func addInputValues(req *JobRequest, name, value, basePath string, sequence bool) error {
+	paths := splitValues(value)
+	if !sequence && (len(paths) > 1 || len(req.Inputs[name]) > 0) {
+		return fmt.Errorf("--%v accepts a single file (use \\, for commas in file names)", name)
+	}
+	urls := []url.URL{}
+	for _, path := range paths {
+		u, err := pathToUri(path, basePath)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, *u)
+	}
+	req.Inputs[name] = append(req.Inputs[name], urls...)
+	return nil
+}
+
 //Returns a function that fills the request option with the subcommand option name
 //and value
 func optionFunc(req *JobRequest, link *PipelineLink, optionType pipeline.DataType, sequence bool) func(string, string) error {
@@ -469,9 +816,12 @@ func optionFunc(req *JobRequest, link *PipelineLink, optionType pipeline.DataTyp
 		if strings.HasPrefix("x-", name) {
 			name = name[2:]
 		}
+		if isFileType(optionType) {
+			req.FileOptions[name] = true
+		}
 		var err error
 		if sequence {
-			for _, v := range strings.Split(value, ",") {
+			for _, v := range splitValues(value) {
 				v, err = validateOption(v, optionType, link)
 				if err != nil {
 					return validationError(name, v, err)
@@ -479,6 +829,9 @@ func optionFunc(req *JobRequest, link *PipelineLink, optionType pipeline.DataTyp
 				req.Options[name] = append(req.Options[name], v)
 			}
 		} else {
+			if len(req.Options[name]) > 0 {
+				return fmt.Errorf("--%v accepts a single value", name)
+			}
 			value, err = validateOption(value, optionType, link)
 			if err != nil {
 				return validationError(name, value, err)
@@ -489,6 +842,15 @@ func optionFunc(req *JobRequest, link *PipelineLink, optionType pipeline.DataTyp
 	}
 }
 
+//Returns true if the option values are files or directories
+func isFileType(optionType pipeline.DataType) bool {
+	switch optionType.(type) {
+	case pipeline.AnyFileURI, pipeline.AnyDirURI:
+		return true
+	}
+	return false
+}
+
 func validationError(optionName, value string, cause error) error {
 	msg := "'" + value + "' is not allowed as the value for option --" + optionName
 	if cause != nil {
@@ -623,7 +985,12 @@ func pathToUri(path string, basePath string) (u *url.URL, err error) {
 	return
 }
 
+//Batch jobs store their ids concurrently
+var lastIdMutex sync.Mutex
+
 func storeLastId(id string) error {
+	lastIdMutex.Lock()
+	defer lastIdMutex.Unlock()
 	file, err := os.Create(LastIdPath)
 	if err != nil {
 		return err
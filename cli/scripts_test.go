@@ -1,14 +1,19 @@
 package cli
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
 
 	"github.com/capitancambio/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
 	//"github.com/capitancambio/go-subcommand"
 	//"github.com/daisy-consortium/pipeline-clientlib-go"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -77,6 +82,26 @@ func TestParseInputsBased(t *testing.T) {
 		t.Errorf("Url 1 is not formated %v", url.String())
 	}
 }
+//Writes a data zip with the files referenced by the script tests
+func createDataZip(t *testing.T) string {
+	path := filepath.Join(os.TempDir(), "dp2_test_data.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for _, name := range []string{"tmp/file", "tmp/file2", "myfile.xml"} {
+		if _, err := w.Create(name); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return path
+}
+
 func TestScriptPriority(t *testing.T) {
 	config := copyConf()
 	config[STARTING] = false
@@ -93,7 +118,7 @@ func TestScriptPriority(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "low"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "low"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -118,7 +143,7 @@ func TestScriptNiceName(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--nicename", "my_job"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--nicename", "my_job"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -142,7 +167,7 @@ func TestScriptPriorityMedium(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	////medium
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "medium"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "medium"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -163,7 +188,7 @@ func TestScriptPriorityHigh(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	////medium
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "high"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "high"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -183,7 +208,7 @@ func TestScriptPriorityWrongValue(t *testing.T) {
 	if err != nil {
 		t.Error("Unexpected error")
 	}
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "not_so_low"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "not_so_low"})
 	if err == nil {
 		t.Errorf("Wrong priority value didn't error")
 	}
@@ -205,7 +230,7 @@ func TestScriptToCommand(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -422,7 +447,7 @@ func TestGetFlagName(t *testing.T) {
 
 }
 func TestGetFlagCommonName(t *testing.T) {
-	name := getFlagName("myflag", "t-", []subcommand.Flag{subcommand.Flag{Long: "--myflag"}})
+	name := getFlagName("myflag", "t-", []subcommand.Flag{subcommand.Flag{Long: "myflag"}})
 	if name != "t-myflag" {
 		t.Errorf("expting t-myflag!= %v", name)
 	}
@@ -435,3 +460,135 @@ func TestGetFlagCommonExists(t *testing.T) {
 	}
 
 }
+
+func TestScriptFlagNames(t *testing.T) {
+	script := pipeline.Script{
+		Id:      "clash",
+		Inputs:  []pipeline.Input{{Name: "source"}, {Name: "output"}},
+		Options: []pipeline.Option{{Name: "source", TypeAttr: "string"}, {Name: "stylesheet", TypeAttr: "string"}},
+	}
+	inputs, options := scriptFlagNames(script)
+	if inputs["source"] != "source" || inputs["output"] != "i-output" {
+		t.Errorf("Wrong input flags %v", inputs)
+	}
+	if options["source"] != "x-source" || options["stylesheet"] != "stylesheet" {
+		t.Errorf("Wrong option flags %v", options)
+	}
+	cli, link, _ := makeReturningCli(nil, t)
+	if _, err := scriptToCommand(script, cli, &link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	flags := map[string]bool{}
+	for _, flag := range cli.Parser.Commands["clash"].Flags() {
+		flags[flag.Long] = true
+	}
+	for _, name := range []string{"source", "i-output", "x-source", "stylesheet"} {
+		if !flags[name] {
+			t.Errorf("--%v not found in the script flags", name)
+		}
+	}
+}
+
+func TestSplitValues(t *testing.T) {
+	tests := []struct {
+		value string
+		exp   []string
+	}{
+		{"a.xml", []string{"a.xml"}},
+		{"a.xml,b.xml", []string{"a.xml", "b.xml"}},
+		{"my\\,book.xml,b.xml", []string{"my,book.xml", "b.xml"}},
+		{"C:\\books\\a.xml", []string{"C:\\books\\a.xml"}},
+	}
+	for _, test := range tests {
+		res := splitValues(test.value)
+		if fmt.Sprint(res) != fmt.Sprint(test.exp) {
+			t.Errorf("Wrong split of %v: %v", test.value, res)
+		}
+	}
+	//existing files are taken as is
+	file := filepath.Join(os.TempDir(), "dp2,comma.xml")
+	ioutil.WriteFile(file, []byte("<a/>"), 0644)
+	defer os.Remove(file)
+	if res := splitValues(file); len(res) != 1 || res[0] != file {
+		t.Errorf("Existing file with a comma was split %v", res)
+	}
+}
+
+func TestInputSequence(t *testing.T) {
+	link := &PipelineLink{FsAllow: false}
+	req := newJobRequest()
+	fn := inputFunc(req, link, true)
+	if err := fn("source", "a.xml,b.xml"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := fn("source", "c.xml"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(req.Inputs["source"]) != 3 || req.Inputs["source"][2].String() != "c.xml" {
+		t.Errorf("Repeated sequence input not appended %v", req.Inputs["source"])
+	}
+}
+
+func TestInputSingle(t *testing.T) {
+	link := &PipelineLink{FsAllow: false}
+	req := newJobRequest()
+	fn := inputFunc(req, link, false)
+	if err := fn("single", "a.xml,b.xml"); err == nil {
+		t.Errorf("A single port accepted several files")
+	}
+	if err := fn("single", "my\\,book.xml"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if req.Inputs["single"][0].String() != "my,book.xml" {
+		t.Errorf("Escaped comma not kept %v", req.Inputs["single"][0].String())
+	}
+	if err := fn("single", "c.xml"); err == nil {
+		t.Errorf("A single port accepted a repeated option")
+	}
+}
+
+func TestOptionSingleRepeated(t *testing.T) {
+	link := &PipelineLink{FsAllow: false}
+	req := newJobRequest()
+	fn := optionFunc(req, link, pipeline.XsString{}, false)
+	if err := fn("title", "my, title"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if req.Options["title"][0] != "my, title" {
+		t.Errorf("Single option value was split %v", req.Options["title"])
+	}
+	if err := fn("title", "other"); err == nil {
+		t.Errorf("A single option accepted a repeated value")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cli, link := makeSubmitCli(t)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err := cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--nicename", "my_job", "--dry-run"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	out := buf.String()
+	for _, exp := range []string{"Script:\t\ttest", "Nicename:\tmy_job", "single:\t./tmp/file2", "another-opt:\tbar", "Data:\t\t"} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("%q not found in the output\n%v", exp, out)
+		}
+	}
+	if strings.Contains(out, "Job ") {
+		t.Errorf("The job was sent")
+	}
+	//the inputs are still checked against the data
+	cli, link = makeSubmitCli(t)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/missing", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--dry-run"})
+	if err == nil || !strings.Contains(err.Error(), "tmp/missing") {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
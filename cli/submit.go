@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	JOB_REQUEST_NS = "http://www.daisy.org/ns/pipeline/data" //Namespace of the webservice documents
+)
+
+//Job request document as accepted by the webservice, in xml or json
+type jobRequestDoc struct {
+	XMLName  xml.Name         `xml:"jobRequest" json:"-"`
+	Xmlns    string           `xml:"xmlns,attr,omitempty" json:"-"`
+	Script   jobRequestScript `xml:"script" json:"script"`
+	Nicename string           `xml:"nicename,omitempty" json:"nicename,omitempty"`
+	Priority string           `xml:"priority,omitempty" json:"priority,omitempty"`
+	Inputs   []jobRequestPort `xml:"input" json:"inputs,omitempty"`
+	Options  []jobRequestPort `xml:"option" json:"options,omitempty"`
+}
+
+type jobRequestScript struct {
+	Href string `xml:"href,attr" json:"href"`
+}
+
+//Input or option of the request. Single options may have their value as text
+type jobRequestPort struct {
+	Name  string           `xml:"name,attr" json:"name"`
+	Value string           `xml:",chardata" json:"value,omitempty"`
+	Items []jobRequestItem `xml:"item" json:"items,omitempty"`
+}
+
+type jobRequestItem struct {
+	Value string `xml:"value,attr" json:"value"`
+}
+
+//Returns the values of the port
+func (p jobRequestPort) values() []string {
+	if len(p.Items) == 0 {
+		return []string{strings.TrimSpace(p.Value)}
+	}
+	values := make([]string, len(p.Items))
+	for idx, item := range p.Items {
+		values[idx] = item.Value
+	}
+	return values
+}
+
+//Returns the id of the script, the last step of its href
+func (d jobRequestDoc) scriptId() string {
+	return path.Base(strings.TrimSuffix(d.Script.Href, "/"))
+}
+
+//Builds the document from the request sent to the webservice, with the
+//inputs and options sorted by name
+func newJobRequestDoc(req pipeline.JobRequest) jobRequestDoc {
+	doc := jobRequestDoc{
+		Xmlns:    JOB_REQUEST_NS,
+		Script:   jobRequestScript{Href: req.Script.Href},
+		Nicename: req.Nicename,
+		Priority: req.Priority,
+	}
+	for _, input := range req.Inputs {
+		port := jobRequestPort{Name: input.Name}
+		for _, item := range input.Items {
+			port.Items = append(port.Items, jobRequestItem{item.Value})
+		}
+		doc.Inputs = append(doc.Inputs, port)
+	}
+	for _, option := range req.Options {
+		port := jobRequestPort{Name: option.Name, Value: option.Value}
+		for _, item := range option.Items {
+			port.Items = append(port.Items, jobRequestItem{item.Value})
+		}
+		doc.Options = append(doc.Options, port)
+	}
+	sort.Sort(portsByName(doc.Inputs))
+	sort.Sort(portsByName(doc.Options))
+	return doc
+}
+
+type portsByName []jobRequestPort
+
+func (p portsByName) Len() int           { return len(p) }
+func (p portsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p portsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+//Writes the request document as json or, otherwise, as xml
+func writeJobRequestDoc(w io.Writer, doc jobRequestDoc, asJson bool) (err error) {
+	var data []byte
+	if asJson {
+		data, err = json.MarshalIndent(doc, "", "  ")
+	} else {
+		data, err = xml.MarshalIndent(doc, "", "  ")
+		data = append([]byte(xml.Header), data...)
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.Write(append(data, '\n'))
+	return
+}
+
+//Reads the request document, json if it starts with { and xml otherwise
+func readJobRequestDoc(file string) (doc jobRequestDoc, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = xml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("Error parsing %v: %v", file, err)
+	}
+	if doc.Script.Href == "" {
+		return doc, fmt.Errorf("%v doesn't define the script to run", file)
+	}
+	return
+}
+
+//Returns the local path of the value, relative paths are resolved against dir.
+//Urls other than file: ones are returned as they are
+func resolveRequestPath(value, dir string) string {
+	if u, err := url.Parse(value); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	if isRemoteUri(value) || filepath.IsAbs(filepath.FromSlash(value)) {
+		return value
+	}
+	return filepath.Join(dir, filepath.FromSlash(value))
+}
+
+//Fills the request with the contents of the document, checking the inputs and
+//options against the script definition. Relative paths are resolved against
+//dir. All the problems are reported at once
+func (r *JobRequest) fromDoc(doc jobRequestDoc, script pipeline.Script, dir string, link *PipelineLink) error {
+	r.Script = script.Id
+	//the nice name and priority given as flags take precedence
+	if r.Nicename == "" {
+		r.Nicename = doc.Nicename
+	}
+	if doc.Priority != "" && !checkPriority(doc.Priority) {
+		return fmt.Errorf("%s is not a valid priority. Allowed values are high, medium and low", doc.Priority)
+	}
+	if r.Priority == "" {
+		r.Priority = doc.Priority
+	}
+	errs := []string{}
+	inputs := map[string]pipeline.Input{}
+	for _, input := range script.Inputs {
+		inputs[input.Name] = input
+	}
+	options := map[string]pipeline.Option{}
+	for _, option := range script.Options {
+		options[option.Name] = option
+	}
+	basePath := getBasePath(link.IsLocal())
+	for _, port := range doc.Inputs {
+		input, ok := inputs[port.Name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown input %v", port.Name))
+			continue
+		}
+		values := port.values()
+		if !input.Sequence && len(values) > 1 {
+			errs = append(errs, fmt.Sprintf("input %v accepts a single file", port.Name))
+			continue
+		}
+		for _, value := range values {
+			var u *url.URL
+			var err error
+			if isRemoteUri(value) && !strings.HasPrefix(value, "file:") {
+				u, err = url.Parse(value)
+			} else {
+				u, err = pathToUri(resolveRequestPath(value, dir), basePath)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("input %v: %v", port.Name, err))
+				continue
+			}
+			r.Inputs[port.Name] = append(r.Inputs[port.Name], *u)
+		}
+	}
+	for _, port := range doc.Options {
+		option, ok := options[port.Name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown option %v", port.Name))
+			continue
+		}
+		values := port.values()
+		if !option.Sequence && len(values) > 1 {
+			errs = append(errs, fmt.Sprintf("option %v accepts a single value", port.Name))
+			continue
+		}
+		if isFileType(option.Type) {
+			r.FileOptions[port.Name] = true
+		}
+		for _, value := range values {
+			if isFileType(option.Type) {
+				value = resolveRequestPath(value, dir)
+			}
+			valid, err := validateOption(value, option.Type, link)
+			if err != nil {
+				errs = append(errs, validationError(port.Name, value, err).Error())
+				continue
+			}
+			r.Options[port.Name] = append(r.Options[port.Name], valid)
+		}
+	}
+	for _, input := range script.Inputs {
+		if _, ok := r.Inputs[input.Name]; input.Required && !ok {
+			errs = append(errs, fmt.Sprintf("missing required input %v", input.Name))
+		}
+	}
+	for _, option := range script.Options {
+		if _, ok := r.Options[option.Name]; option.Required && !ok {
+			errs = append(errs, fmt.Sprintf("missing required option %v", option.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid job request:\n\t%v", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+//Prints the request as it would be sent to the webservice, as json if that's
+//the selected format and as xml otherwise. When the files are to be packaged
+//their paths are made absolute, so that the request can be submitted from
+//anywhere
+func (c *Cli) dumpRequest(req JobRequest, link PipelineLink) error {
+	if !link.IsLocal() && req.Data == nil {
+		req = *req.copy()
+		absolute := func(value string) string {
+			if abs, err := filepath.Abs(filepath.FromSlash(value)); err == nil && !isRemoteUri(value) {
+				return filepath.ToSlash(abs)
+			}
+			return value
+		}
+		for _, values := range req.Inputs {
+			for idx, value := range values {
+				values[idx] = url.URL{Opaque: absolute(value.Opaque)}
+			}
+		}
+		for name := range req.FileOptions {
+			for idx, value := range req.Options[name] {
+				req.Options[name][idx] = absolute(value)
+			}
+		}
+	}
+	pReq, err := jobRequestToPipeline(req, link)
+	if err != nil {
+		return err
+	}
+	return writeJobRequestDoc(c.Output, newJobRequestDoc(pReq), c.Format == FORMAT_JSON)
+}
+
+//Adds the submit command, that sends the job request document given in xml or
+//json and follows its execution like the script commands do
+func AddSubmitCommand(cli *Cli, link *PipelineLink) {
+	jExec := jobExecution{
+		link:    link,
+		req:     newJobRequest(),
+		verbose: true,
+	}
+	cmd := cli.AddCommand("submit", "Sends the job request given in FILE (xml or json, as printed by --dump-request)", func(command string, args ...string) error {
+		doc, err := readJobRequestDoc(args[0])
+		if err != nil {
+			return err
+		}
+		script, err := link.Script(doc.scriptId())
+		if err != nil {
+			return fmt.Errorf("Error loading script %v: %v", doc.scriptId(), err)
+		}
+		dir, err := filepath.Abs(filepath.Dir(args[0]))
+		if err != nil {
+			return err
+		}
+		//the paths are relative to the zip root if the data is given
+		if jExec.req.Data != nil {
+			dir = ""
+		}
+		if jExec.report && jExec.req.Background {
+			return errors.New("--report can't be used in the background")
+		}
+		if err = jExec.req.fromDoc(doc, script, dir, link); err != nil {
+			return err
+		}
+		return jExec.run(cli.Output)
+	})
+	cmd.SetArity(1, "FILE")
+	addJobFlags(cmd, &jExec)
+	addDataFlag(cmd, jExec.req)
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeSubmitCli(t *testing.T) (*Cli, *PipelineLink) {
+	config := copyConf()
+	config[STARTING] = false
+	pipeline := newPipelineTest(false)
+	pipeline.fsallow = false
+	link := &PipelineLink{pipeline: pipeline, config: config}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return cli, link
+}
+
+func TestDumpRequest(t *testing.T) {
+	cli, link := makeSubmitCli(t)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err := cli.Run([]string{"test", "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "high", "--dump-request"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	out := buf.String()
+	wd, _ := os.Getwd()
+	for _, exp := range []string{
+		`<jobRequest xmlns="` + JOB_REQUEST_NS + `">`,
+		`<script href="test"></script>`,
+		`<priority>high</priority>`,
+		`<item value="` + filepath.ToSlash(filepath.Join(wd, "tmp", "file")) + `"></item>`,
+		`<option name="another-opt">bar</option>`,
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("%v not found in the request\n%v", exp, out)
+		}
+	}
+	if strings.Contains(out, "Job ") {
+		t.Errorf("The job was sent")
+	}
+}
+
+func TestDumpAndSubmit(t *testing.T) {
+	data := createDataZip(t)
+	cli, link := makeSubmitCli(t)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	cli.Format = FORMAT_JSON
+	err := cli.Run([]string{"test", "-d", data, "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--dump-request"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	file := filepath.Join(os.TempDir(), "dp2_request.json")
+	ioutil.WriteFile(file, buf.Bytes(), 0644)
+	defer os.Remove(file)
+	doc, err := readJobRequestDoc(file)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if doc.scriptId() != "test" || len(doc.Inputs) != 2 || doc.Inputs[0].Name != "single" {
+		t.Errorf("Wrong request read %+v", doc)
+	}
+
+	cli, link = makeSubmitCli(t)
+	AddSubmitCommand(cli, link)
+	err = cli.Run([]string{"submit", "-d", data, "-o", os.TempDir(), file})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestSubmitValidation(t *testing.T) {
+	file := filepath.Join(os.TempDir(), "dp2_request.xml")
+	ioutil.WriteFile(file, []byte(`<jobRequest xmlns="http://www.daisy.org/ns/pipeline/data">
+  <script href="http://localhost:8181/ws/scripts/test"/>
+  <input name="single"><item value="a.xml"/><item value="b.xml"/></input>
+  <option name="another-opt">baz</option>
+  <option name="unknown">1</option>
+</jobRequest>`), 0644)
+	defer os.Remove(file)
+	cli, link := makeSubmitCli(t)
+	AddSubmitCommand(cli, link)
+	err := cli.Run([]string{"submit", "-o", os.TempDir(), file})
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	for _, exp := range []string{"input single accepts a single file", "--another-opt", "unknown option unknown", "missing required option test-opt"} {
+		if !strings.Contains(err.Error(), exp) {
+			t.Errorf("%q not found in %v", exp, err)
+		}
+	}
+}
+
+//Checks that submit has the same job flags as the script commands
+func TestSubmitFlags(t *testing.T) {
+	cli, link := makeSubmitCli(t)
+	AddSubmitCommand(cli, link)
+	flags := map[string]bool{}
+	for _, flag := range cli.Parser.Commands["submit"].Flags() {
+		flags["--"+flag.Long] = true
+	}
+	scriptOnly := map[string]bool{"--save-template": true, "--dump-request": true, "--dry-run": true, "--batch": true, "--parallel": true}
+	for _, flag := range append(commonFlags, "--data") {
+		if !scriptOnly[flag] && !flags[flag] {
+			t.Errorf("%v not found in the submit flags", flag)
+		}
+	}
+}
+
+func TestSubmitFlagsPrecedence(t *testing.T) {
+	file := filepath.Join(os.TempDir(), "dp2_request.xml")
+	ioutil.WriteFile(file, []byte(`<jobRequest xmlns="http://www.daisy.org/ns/pipeline/data">
+  <script href="http://localhost:8181/ws/scripts/test"/>
+  <nicename>from the request</nicename>
+  <priority>low</priority>
+</jobRequest>`), 0644)
+	defer os.Remove(file)
+	doc, err := readJobRequestDoc(file)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli, link := makeSubmitCli(t)
+	req := newJobRequest()
+	req.Nicename = "from the flags"
+	req.fromDoc(doc, SCRIPT, os.TempDir(), link)
+	if req.Nicename != "from the flags" || req.Priority != "low" {
+		t.Errorf("Wrong nice name or priority %q %q", req.Nicename, req.Priority)
+	}
+	AddSubmitCommand(cli, link)
+	err = cli.Run([]string{"submit", "-b", "--report", file})
+	if err == nil || !strings.Contains(err.Error(), "--report") {
+		t.Errorf("Expected --report to be rejected in the background, got %v", err)
+	}
+}
+
+func TestResolveRequestPath(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator)+"requests", "dir")
+	tests := []struct {
+		value, exp string
+	}{
+		{"book.xml", filepath.Join(dir, "book.xml")},
+		{"http://example.org/book.xml", "http://example.org/book.xml"},
+		{"file:///books/book.xml", filepath.FromSlash("/books/book.xml")},
+	}
+	for _, test := range tests {
+		if res := resolveRequestPath(test.value, dir); res != test.exp {
+			t.Errorf("Wrong resolution of %v: %v", test.value, res)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/capitancambio/go-subcommand"
+	"launchpad.net/goyaml"
+)
+
+const (
+	TEMPLATES_DIR = "templates" //Folder of the job templates, next to the user configuration file
+	TEMPLATE_EXT  = ".yml"
+
+	JobTemplatesTemplate = `{{range .}}{{.Name}}	{{.Script}}
+{{end}}`
+)
+
+var templateNameRe = regexp.MustCompile(`^[\w.-]+$`)
+
+//Short names of the script command flags, used to know which template values
+//are overridden
+var scriptShortFlags = map[string]string{
+	"o": "output",
+	"z": "zip",
+	"n": "nicename",
+	"r": "priority",
+	"q": "quiet",
+	"p": "persistent",
+	"b": "background",
+	"d": "data",
+}
+
+//Script invocation saved with --save-template. It contains every flag given
+//to the script command but the inputs, the data and the template name, so
+//that they are given when the template is run
+type jobTemplate struct {
+	Script   string              `yaml:"script"`
+	Options  map[string][]string `yaml:"options,omitempty"`  //values of the options by flag name
+	Switches []string            `yaml:"switches,omitempty"` //switches given
+}
+
+//Template as listed by dp2 run
+type templateEntry struct {
+	Name   string
+	Script string
+}
+
+func newJobTemplate(script string) *jobTemplate {
+	return &jobTemplate{Script: script, Options: map[string][]string{}}
+}
+
+//Wraps the flag function so that the value is recorded in the template, if
+//there is one
+func (t *jobTemplate) option(fn subcommand.FlagFunction) subcommand.FlagFunction {
+	if t == nil {
+		return fn
+	}
+	return func(name, value string) error {
+		t.Options[name] = append(t.Options[name], value)
+		return fn(name, value)
+	}
+}
+
+//Wraps the switch function so that it's recorded in the template, if there
+//is one
+func (t *jobTemplate) switchFn(fn subcommand.FlagFunction) subcommand.FlagFunction {
+	if t == nil {
+		return fn
+	}
+	return func(name, value string) error {
+		t.Switches = append(t.Switches, name)
+		return fn(name, value)
+	}
+}
+
+//Returns the arguments of the script command, leaving out the flags in overridden
+func (t jobTemplate) args(overridden map[string]bool) []string {
+	args := []string{t.Script}
+	names := make([]string, 0, len(t.Options))
+	for name := range t.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if overridden[name] {
+			continue
+		}
+		for _, value := range t.Options[name] {
+			args = append(args, "--"+name, value)
+		}
+	}
+	for _, name := range t.Switches {
+		if !overridden[name] {
+			args = append(args, "--"+name)
+		}
+	}
+	return args
+}
+
+//Returns the folder where the templates are stored
+func templatesDir() string {
+	return filepath.Join(filepath.Dir(userConfigPath()), TEMPLATES_DIR)
+}
+
+func templatePath(name string) (string, error) {
+	if !templateNameRe.MatchString(name) {
+		return "", fmt.Errorf("Invalid template name %v, use letters, digits, '.', '-' and '_'", name)
+	}
+	return filepath.Join(templatesDir(), name+TEMPLATE_EXT), nil
+}
+
+//Writes the template, returns the path where it was stored
+func saveTemplate(name string, t jobTemplate) (string, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := goyaml.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	if err = mkdir(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, data, 0644)
+}
+
+//Reads the template
+func loadTemplate(name string) (t jobTemplate, err error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, fmt.Errorf("Template %v not found, the available ones are listed by run", name)
+	} else if err != nil {
+		return
+	}
+	if err = goyaml.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("Error parsing %v: %v", path, err)
+	}
+	if t.Script == "" {
+		return t, fmt.Errorf("%v doesn't define the script to run", path)
+	}
+	return
+}
+
+//Lists the stored templates
+func listTemplates() (entries []templateEntry, err error) {
+	entries = []templateEntry{}
+	files, err := filepath.Glob(filepath.Join(templatesDir(), "*"+TEMPLATE_EXT))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), TEMPLATE_EXT)
+		entry := templateEntry{Name: name}
+		if t, err := loadTemplate(name); err == nil {
+			entry.Script = t.Script
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+//Replaces run NAME by the script command and flags stored in the template.
+//The flags given after the name override the ones in the template. Returns
+//the args untouched if no name is given
+func expandTemplate(args []string, idx int) ([]string, error) {
+	if idx+1 >= len(args) || strings.HasPrefix(args[idx+1], "-") {
+		return args, nil
+	}
+	t, err := loadTemplate(args[idx+1])
+	if err != nil {
+		return nil, err
+	}
+	overrides := args[idx+2:]
+	overridden := map[string]bool{}
+	for _, arg := range overrides {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if long, ok := scriptShortFlags[name]; ok && !strings.HasPrefix(arg, "--") {
+			name = long
+		}
+		overridden[name] = true
+		//the exists policies are exclusive
+		for _, sw := range existsPolicySwitches {
+			if sw.name == name {
+				for _, other := range existsPolicySwitches {
+					overridden[other.name] = true
+				}
+			}
+		}
+	}
+	expanded := append([]string{}, args[:idx]...)
+	expanded = append(expanded, t.args(overridden)...)
+	return append(expanded, overrides...), nil
+}
+
+//Adds the run command, that lists the templates when called without name.
+//Cli.Run replaces the command by the template contents otherwise
+func AddRunCommand(cli *Cli, link PipelineLink) {
+	cmd := cli.AddCommand("run", "Runs the script invocation saved with --save-template NAME, the flags given after the name override the stored ones", func(command string, args ...string) error {
+		if len(args) > 0 {
+			return UsageError{fmt.Errorf("Usage: %v NAME [OPTIONS]", command)}
+		}
+		entries, err := listTemplates()
+		if err != nil {
+			return err
+		}
+		return commandBuilder{template: JobTemplatesTemplate}.writeOutput(entries, cli)
+	})
+	cmd.SetArity(-1, "NAME [OPTIONS]")
+	cli.offline[cmd.Name] = true
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func makeTemplateCli(t *testing.T) (*Cli, *JobRequest) {
+	config := copyConf()
+	config[STARTING] = false
+	pipeline := newPipelineTest(false)
+	pipeline.fsallow = false
+	link := &PipelineLink{pipeline: pipeline, config: config}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	req, err := scriptToCommand(SCRIPT, cli, link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddRunCommand(cli, *link)
+	return cli, req
+}
+
+func TestSaveAndRunTemplate(t *testing.T) {
+	_, _, restore := withUserConfigDirs(t)
+	defer restore()
+	data := createDataZip(t)
+	cli, _ := makeTemplateCli(t)
+	err := cli.Run([]string{"test", "-o", os.TempDir(), "-d", data, "--source", "./tmp/file", "--single", "./tmp/file2",
+		"--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "low", "-q", "--save-template", "weekly"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tmpl, err := loadTemplate("weekly")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if tmpl.Script != "test" || tmpl.Options["another-opt"][0] != "bar" || tmpl.Options["priority"][0] != "low" {
+		t.Errorf("Wrong template %+v", tmpl)
+	}
+	for _, name := range []string{"source", "single", "data", "save-template"} {
+		if _, ok := tmpl.Options[name]; ok {
+			t.Errorf("%v shouldn't be saved in the template", name)
+		}
+	}
+	if len(tmpl.Switches) != 1 || tmpl.Switches[0] != "quiet" {
+		t.Errorf("Wrong switches %v", tmpl.Switches)
+	}
+
+	cli, req := makeTemplateCli(t)
+	err = cli.Run([]string{"run", "weekly", "-d", data, "--source", "./tmp/file", "--single", "./tmp/file2", "-r", "high"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if req.Priority != "high" {
+		t.Errorf("The priority wasn't overridden %v", req.Priority)
+	}
+	if len(req.Options["another-opt"]) != 1 || req.Options["another-opt"][0] != "bar" {
+		t.Errorf("The template option wasn't applied %v", req.Options)
+	}
+}
+
+func TestRunTemplateValidation(t *testing.T) {
+	_, _, restore := withUserConfigDirs(t)
+	defer restore()
+	//the stored values are checked against the script again
+	if _, err := saveTemplate("broken", jobTemplate{Script: "test", Options: map[string][]string{"another-opt": []string{"baz"}}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli, _ := makeTemplateCli(t)
+	err := cli.Run([]string{"run", "broken", "-d", createDataZip(t), "--test-opt", "./myfile.xml", "-o", os.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "another-opt") {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+	cli, _ = makeTemplateCli(t)
+	if err := cli.Run([]string{"run", "missing"}); err == nil {
+		t.Errorf("Expected error for a missing template")
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	_, _, restore := withUserConfigDirs(t)
+	defer restore()
+	tmpl := jobTemplate{
+		Script:   "dtbook-to-epub3",
+		Options:  map[string][]string{"output": []string{"out"}, "nicename": []string{"weekly"}},
+		Switches: []string{"skip-existing", "zip"},
+	}
+	if _, err := saveTemplate("weekly", tmpl); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	args, err := expandTemplate([]string{"--host", "http://remote", "run", "weekly", "-o", "other", "--overwrite"}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	exp := "--host http://remote dtbook-to-epub3 --nicename weekly --zip -o other --overwrite"
+	if strings.Join(args, " ") != exp {
+		t.Errorf("Wrong expansion %v", args)
+	}
+}
+
+func TestRunListTemplates(t *testing.T) {
+	_, _, restore := withUserConfigDirs(t)
+	defer restore()
+	saveTemplate("weekly", jobTemplate{Script: "dtbook-to-epub3"})
+	if _, err := saveTemplate("bad name", jobTemplate{Script: "test"}); err == nil {
+		t.Errorf("Invalid template name accepted")
+	}
+	cli, _ := makeTemplateCli(t)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	if err := cli.Run([]string{"run"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.String() != "weekly\tdtbook-to-epub3\n" {
+		t.Errorf("Wrong template list %q", buf.String())
+	}
+}
@@ -2,17 +2,18 @@ package cli
 
 import (
 	"archive/zip"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	re "regexp"
 	"runtime"
 	"strconv"
+	"strings"
 
 	"github.com/capitancambio/go-subcommand"
 )
@@ -54,7 +55,7 @@ func loadKey() (key string, err error) {
 //Checks if the job id is present when the command was called
 func checkId(lastId bool, command string, args ...string) (id string, err error) {
 	if len(args) != 1 && !lastId {
-		return id, fmt.Errorf("Command %v needs a job id", command)
+		return id, UsageError{fmt.Errorf("Command %v needs a job id", command)}
 	}
 	//got it from file
 	if lastId {
@@ -67,6 +68,22 @@ func checkId(lastId bool, command string, args ...string) (id string, err error)
 	}
 }
 
+//Checks if at least one job id is present when the command was called. The
+//last id is added in front of the ids if requested
+func checkIds(lastId bool, command string, args ...string) (ids []string, err error) {
+	if len(args) == 0 && !lastId {
+		return ids, UsageError{fmt.Errorf("Command %v needs at least one job id", command)}
+	}
+	if lastId {
+		id, err := getLastId()
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return append(ids, args...), nil
+}
+
 //Adds the last id switch to the command
 func addLastId(cmd *subcommand.Command, lastId *bool) {
 	cmd.AddSwitch("lastid", "l", "Get id from the last executed job instead of JOB_ID", func(string, string) error {
@@ -93,76 +110,200 @@ func mkdir(path string) error {
 	return nil
 }
 
+//What to do when a result file is already in the output folder
+type existsPolicy int
+
+const (
+	EXISTS_DEFAULT existsPolicy = iota //overwrite, as no policy was given
+	EXISTS_OVERWRITE
+	EXISTS_SKIP
+	EXISTS_FAIL
+)
+
+//Switches that select the exists policy
+var existsPolicySwitches = []struct {
+	name   string
+	desc   string
+	policy existsPolicy
+}{
+	{"overwrite", "Overwrite the files that already exist in the output (default)", EXISTS_OVERWRITE},
+	{"skip-existing", "Keep the files that already exist in the output", EXISTS_SKIP},
+	{"fail-if-exists", "Fail without writing anything if a file already exists in the output", EXISTS_FAIL},
+}
+
+//Adds the --overwrite, --skip-existing and --fail-if-exists switches to the
+//command, recording them in the template if it's not nil
+func addExistsPolicySwitches(cmd *subcommand.Command, policy *existsPolicy, settings *jobTemplate) {
+	for _, sw := range existsPolicySwitches {
+		sw := sw
+		var fn subcommand.FlagFunction = func(string, string) error {
+			if *policy != EXISTS_DEFAULT && *policy != sw.policy {
+				return errors.New("--overwrite, --skip-existing and --fail-if-exists can't be combined")
+			}
+			*policy = sw.policy
+			return nil
+		}
+		if settings != nil {
+			fn = settings.switchFn(fn)
+		}
+		cmd.AddSwitch(sw.name, "", sw.desc, fn)
+	}
+}
+
+//Returns an error if the zip entry would be written outside of folder or is
+//not a regular file or directory
+func checkZipEntry(folder string, f *zip.File) (path string, err error) {
+	name := filepath.FromSlash(f.Name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(f.Name, "/") || strings.HasPrefix(f.Name, "\\") {
+		return "", fmt.Errorf("Refusing to extract %v from the results: absolute paths are not allowed", f.Name)
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("Refusing to extract %v from the results: symbolic links are not allowed", f.Name)
+	}
+	if !f.Mode().IsRegular() && !f.Mode().IsDir() {
+		return "", fmt.Errorf("Refusing to extract %v from the results: it's not a regular file", f.Name)
+	}
+	path = filepath.Join(folder, name)
+	rel, err := filepath.Rel(folder, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Refusing to extract %v from the results: it points outside of %v", f.Name, folder)
+	}
+	return path, nil
+}
+
+//Extracts the zip data written to it into a folder once it's closed. The data
+//is kept in a temporary file in the meanwhile. The entries are checked before
+//writing anything, so that a zip with entries escaping the folder, absolute
+//paths or symbolic links is rejected as a whole
 type ZipInflator struct {
-	folder string
-	buff   *bytes.Buffer
+	folder  string
+	file    *os.File
+	policy  existsPolicy
+	written []string //files extracted, the skipped ones are left out
 }
 
 func NewZipInflator(folder string) *ZipInflator {
 	return &ZipInflator{
 		folder: folder,
-		buff:   bytes.NewBuffer([]byte{}),
 	}
 
 }
 
-//Writes the  data to a intermediate buffer
+//Writes the data to the temporary file
 func (z *ZipInflator) Write(data []byte) (int, error) {
-	return z.buff.Write(data)
+	if z.file == nil {
+		file, err := ioutil.TempFile("", "dp2-results-")
+		if err != nil {
+			return 0, err
+		}
+		z.file = file
+	}
+	return z.file.Write(data)
 }
 
-//
+//Extracts the files and removes the temporary file
 func (z *ZipInflator) Close() error {
-	l := int64(z.buff.Len())
-	//if  no data do not try to compress it
-	if l == 0 {
+	//if  no data do not try to uncompress it
+	if z.file == nil {
 		return nil
 	}
-	reader, err := zip.NewReader(bytes.NewReader(z.buff.Bytes()), l)
+	defer func() {
+		z.file.Close()
+		os.Remove(z.file.Name())
+	}()
+	info, err := z.file.Stat()
 	if err != nil {
 		return err
 	}
-	// Iterate through the files in the archive,
-	//and store the results
-	for _, f := range reader.File {
-		//Get the path of the new file
-		path := filepath.Join(z.folder, filepath.Clean(f.Name))
-		if err := mkdir(filepath.Dir(path)); err != nil {
+	if info.Size() == 0 {
+		return nil
+	}
+	reader, err := zip.NewReader(z.file, info.Size())
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(reader.File))
+	for idx, f := range reader.File {
+		if paths[idx], err = checkZipEntry(z.folder, f); err != nil {
 			return err
 		}
-
-		rc, err := f.Open()
-		if err != nil {
-			return err
+		if z.policy != EXISTS_FAIL || f.Mode().IsDir() {
+			continue
 		}
-
-		dest, err := os.Create(path)
-		if err != nil {
-			return err
+		if _, err := os.Lstat(paths[idx]); err == nil {
+			return fmt.Errorf("%v already exists", paths[idx])
 		}
-
-		if _, err = io.Copy(dest, rc); err != nil {
-			return err
+	}
+	// Iterate through the files in the archive,
+	//and store the results
+	for idx, f := range reader.File {
+		path := paths[idx]
+		if f.Mode().IsDir() {
+			if err := mkdir(path); err != nil {
+				return err
+			}
+			continue
 		}
-
-		if err := dest.Close(); err != nil {
+		if z.policy == EXISTS_SKIP {
+			if _, err := os.Lstat(path); err == nil {
+				log.Printf("Skipping %v as it already exists", path)
+				continue
+			}
+		}
+		if err := mkdir(filepath.Dir(path)); err != nil {
 			return err
 		}
-
-		if err := rc.Close(); err != nil {
+		if err := extractZipEntry(f, path); err != nil {
 			return err
 		}
-
+		z.written = append(z.written, path)
 	}
 	return nil
 }
 
-func zipProcessor(file string, asZip bool) (io.WriteCloser, error) {
+//Writes the contents of the zip entry into path
+func extractZipEntry(f *zip.File, path string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dest, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dest, rc); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
+
+//Discards the data written to it
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+//Returns the writer where the results are stored, either a zip file or a
+//folder where they are extracted, following the exists policy
+func zipProcessor(file string, asZip bool, policy existsPolicy) (io.WriteCloser, error) {
 	if asZip {
+		if _, err := os.Stat(file); err == nil {
+			switch policy {
+			case EXISTS_FAIL:
+				return nil, fmt.Errorf("%v already exists", file)
+			case EXISTS_SKIP:
+				log.Printf("Skipping %v as it already exists", file)
+				return nopWriteCloser{ioutil.Discard}, nil
+			}
+		}
 		return os.Create(file)
-	} else {
-		return NewZipInflator(file), nil
 	}
+	inflator := NewZipInflator(file)
+	inflator.policy = policy
+	return inflator, nil
 }
 
 //gets the path for last id file
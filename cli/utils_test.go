@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -87,6 +88,122 @@ func TestDumpFiles(t *testing.T) {
 
 }
 
+//Creates a zip with a single entry
+func createZipEntry(t *testing.T, header *zip.FileHeader, body string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	f.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func inflate(folder string, policy existsPolicy, data []byte) error {
+	zi := NewZipInflator(folder)
+	zi.policy = policy
+	zi.Write(data)
+	return zi.Close()
+}
+
+//Entries escaping the folder, absolute paths and symlinks are rejected
+func TestZipInflatorUnsafeEntries(t *testing.T) {
+	folder := filepath.Join(os.TempDir(), "pipeline_unsafe_test")
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+	link := &zip.FileHeader{Name: "link"}
+	link.SetMode(os.ModeSymlink | 0777)
+	for _, header := range []*zip.FileHeader{
+		&zip.FileHeader{Name: "../evil.txt"},
+		&zip.FileHeader{Name: "fold/../../evil.txt"},
+		&zip.FileHeader{Name: "/tmp/evil.txt"},
+		link,
+	} {
+		err := inflate(folder, EXISTS_DEFAULT, createZipEntry(t, header, "evil"))
+		if err == nil {
+			t.Errorf("%v should've been rejected", header.Name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(os.TempDir(), "evil.txt")); err == nil {
+		t.Errorf("A file was written outside of the output folder")
+	}
+	if _, err := os.Stat(folder); err == nil {
+		t.Errorf("Nothing should've been written")
+	}
+}
+
+func TestZipInflatorExistsPolicy(t *testing.T) {
+	folder := filepath.Join(os.TempDir(), "pipeline_policy_test")
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+	os.MkdirAll(folder, 0755)
+	existing := filepath.Join(folder, "readme.txt")
+	ioutil.WriteFile(existing, []byte("old"), 0644)
+	read := func(path string) string {
+		data, _ := ioutil.ReadFile(path)
+		return string(data)
+	}
+
+	if err := inflate(folder, EXISTS_FAIL, createZipFile(t)); err == nil {
+		t.Errorf("Expected error as readme.txt exists")
+	}
+	if _, err := os.Stat(filepath.Join(folder, "fold1")); err == nil {
+		t.Errorf("Files were written even though the extraction failed")
+	}
+
+	if err := inflate(folder, EXISTS_SKIP, createZipFile(t)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if read(existing) != "old" {
+		t.Errorf("The existing file was overwritten")
+	}
+	if read(filepath.Join(folder, "fold1", "gopher.txt")) != files[1].Body {
+		t.Errorf("The missing files weren't extracted")
+	}
+
+	if err := inflate(folder, EXISTS_OVERWRITE, createZipFile(t)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if read(existing) != files[0].Body {
+		t.Errorf("The existing file wasn't overwritten")
+	}
+}
+
+func TestZipProcessorExistingFile(t *testing.T) {
+	file := filepath.Join(os.TempDir(), "pipeline_policy_test.zip")
+	ioutil.WriteFile(file, []byte("old"), 0644)
+	defer os.Remove(file)
+	if _, err := zipProcessor(file, true, EXISTS_FAIL); err == nil {
+		t.Errorf("Expected error as the zip exists")
+	}
+	wc, err := zipProcessor(file, true, EXISTS_SKIP)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	wc.Write([]byte("new"))
+	wc.Close()
+	if data, _ := ioutil.ReadFile(file); string(data) != "old" {
+		t.Errorf("The existing zip was overwritten")
+	}
+}
+
+func TestExistsPolicySwitches(t *testing.T) {
+	link := PipelineLink{pipeline: newPipelineTest(false), config: copyConf()}
+	cli, err := makeCli("testprog", &link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddResultsCommand(cli, link)
+	err = cli.Run([]string{"results", "-o", "out", "--skip-existing", "--fail-if-exists", "id"})
+	if err == nil {
+		t.Errorf("Combining the policies should fail")
+	}
+}
+
 //Creates a fake key file
 func createKeyFile(keyFile, key string) (file *os.File, err error) {
 	path := filepath.Join(os.TempDir(), keyFile)
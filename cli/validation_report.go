@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/capitancambio/blackterm"
+)
+
+const (
+	REPORT_ERRORS          = 10 //errors listed in the validation summary
+	VALIDATION_STATUS_PORT = "validation-status"
+	PIPELINE_DATA_NS       = "http://www.daisy.org/ns/pipeline/data"
+)
+
+//Result ports where the validator scripts store their xml validation reports
+var validationReportPorts = []string{"report", "xml-report", "validation-report"}
+
+//Severities of the validation messages, from the most to the least severe
+var validationSeverities = []string{"error", "warning", "info"}
+
+//A message of a validation report
+type validationIssue struct {
+	Severity string `xml:"severity,attr"`
+	Desc     string `xml:"desc"`
+	File     string `xml:"file"`
+	Location struct {
+		Line   string `xml:"line,attr"`
+		Column string `xml:"column,attr"`
+	} `xml:"location"`
+	Document string `xml:"-"` //name of the document validated
+}
+
+//Where the issue was found: file:line:column
+func (v validationIssue) where() string {
+	where := v.Document
+	if v.File != "" {
+		where = path.Base(v.File)
+	}
+	for _, pos := range []string{v.Location.Line, v.Location.Column} {
+		if pos == "" {
+			break
+		}
+		where += ":" + pos
+	}
+	return where
+}
+
+//What the validation reports found
+type validationSummary struct {
+	Reports int
+	Counts  map[string]int    //issues per severity
+	Errors  []validationIssue //the first REPORT_ERRORS errors
+	Invalid bool              //the validation status is error
+}
+
+func newValidationSummary() *validationSummary {
+	return &validationSummary{Counts: map[string]int{}}
+}
+
+//Reads the validation reports and status found in the results stored in the
+//zip file
+func readZippedValidationReports(file string) (*validationSummary, error) {
+	summary := newValidationSummary()
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	for _, entry := range zr.File {
+		if !isValidationReport(entry.Name) {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = summary.read(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the validation report %v: %v", entry.Name, err)
+		}
+	}
+	return summary, nil
+}
+
+//Reads the validation reports and status among the result files extracted
+//into folder. Other files in the folder, like the results of previous jobs,
+//are left out
+func readValidationReports(folder string, files []string) (*validationSummary, error) {
+	summary := newValidationSummary()
+	for _, file := range files {
+		rel, err := filepath.Rel(folder, file)
+		if err != nil || !isValidationReport(filepath.ToSlash(rel)) {
+			continue
+		}
+		r, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		err = summary.read(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the validation report %v: %v", file, err)
+		}
+	}
+	return summary, nil
+}
+
+//Returns true if the result entry is an xml document from the validation ports
+func isValidationReport(entry string) bool {
+	port := strings.SplitN(entry, "/", 2)[0]
+	if port == VALIDATION_STATUS_PORT {
+		return strings.HasSuffix(entry, ".xml")
+	}
+	for _, p := range validationReportPorts {
+		if p == port {
+			return strings.HasSuffix(entry, ".xml")
+		}
+	}
+	return false
+}
+
+//Adds the messages and the status of the xml document
+func (s *validationSummary) read(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	document := ""
+	found := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Space != PIPELINE_DATA_NS {
+			continue
+		}
+		switch start.Name.Local {
+		case "document-validation-report", "validation-report":
+			found = true
+		case "document-name":
+			if err := decoder.DecodeElement(&document, &start); err != nil {
+				return err
+			}
+		case "message":
+			issue := validationIssue{}
+			if err := decoder.DecodeElement(&issue, &start); err != nil {
+				return err
+			}
+			issue.Document = document
+			s.add(issue)
+		case "validation-status":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "result" && attr.Value == "error" {
+					s.Invalid = true
+				}
+			}
+		}
+	}
+	if found {
+		s.Reports++
+	}
+	return nil
+}
+
+func (s *validationSummary) add(issue validationIssue) {
+	issue.Severity = strings.ToLower(issue.Severity)
+	if issue.Severity == "" {
+		issue.Severity = "error"
+	}
+	s.Counts[issue.Severity]++
+	if issue.Severity == "error" && len(s.Errors) < REPORT_ERRORS {
+		s.Errors = append(s.Errors, issue)
+	}
+}
+
+//Returns true if the validation found errors
+func (s validationSummary) failed() bool {
+	return s.Counts["error"] > 0 || s.Invalid
+}
+
+//The summary in markdown, to be rendered with blackterm
+func (s validationSummary) markdown() string {
+	if s.Reports == 0 && !s.Invalid {
+		return "No validation report found in the results\n"
+	}
+	others := []string{}
+	for severity := range s.Counts {
+		if !contains(validationSeverities, severity) {
+			others = append(others, severity)
+		}
+	}
+	sort.Strings(others)
+	//the errors are always counted, the other severities if found
+	counts := []string{}
+	for _, severity := range append(append([]string{}, validationSeverities...), others...) {
+		if n := s.Counts[severity]; n > 0 || severity == "error" {
+			counts = append(counts, fmt.Sprintf("%d %v", n, plural(severity, n)))
+		}
+	}
+	result := "**Validation passed**"
+	if s.failed() {
+		result = "**Validation failed**"
+	}
+	md := fmt.Sprintf("%v: %v\n\n", result, strings.Join(counts, ", "))
+	for _, issue := range s.Errors {
+		md += fmt.Sprintf("* `%v` %v\n", issue.where(), escapeMarkdown(firstLine(strings.TrimSpace(issue.Desc))))
+	}
+	if more := s.Counts["error"] - len(s.Errors); more > 0 {
+		md += fmt.Sprintf("* _and %d more %v_\n", more, plural("error", more))
+	}
+	return md
+}
+
+//Prints the summary using the terminal styles
+func (s validationSummary) print(w io.Writer) {
+	fmt.Fprintln(w, blackterm.MarkdownString(s.markdown()))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func plural(word string, n int) string {
+	if n == 1 || word == "info" {
+		return word
+	}
+	return word + "s"
+}
+
+//Escapes the characters that markdown would take as formatting
+func escapeMarkdown(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`).Replace(text)
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func validationReport(errors, warnings int) string {
+	report := `<?xml version="1.0" encoding="UTF-8"?>
+<d:document-validation-report xmlns:d="http://www.daisy.org/ns/pipeline/data">
+  <d:document-info><d:document-name>book.xml</d:document-name></d:document-info>
+  <d:reports><d:report>`
+	for i := 1; i <= errors; i++ {
+		report += fmt.Sprintf(`<d:message severity="error"><d:desc>Error_%d</d:desc><d:file>file:/tmp/book.xml</d:file><d:location line="%d" column="3"/></d:message>`, i, i*10)
+	}
+	for i := 1; i <= warnings; i++ {
+		report += `<d:message severity="warning"><d:desc>Warning</d:desc></d:message>`
+	}
+	return report + `</d:report></d:reports></d:document-validation-report>`
+}
+
+//The results of a validator, the result port has a message that isn't part of
+//a report
+func validationResults(errors int) map[string]string {
+	status := "ok"
+	if errors > 0 {
+		status = "error"
+	}
+	return map[string]string{
+		"xml-report/report.xml":        validationReport(errors, 1),
+		"validation-status/status.xml": `<d:validation-status xmlns:d="http://www.daisy.org/ns/pipeline/data" result="` + status + `"/>`,
+		"result/book.xml":              `<d:message xmlns:d="http://www.daisy.org/ns/pipeline/data" severity="error"/>`,
+		"html-report/report.xhtml":     "<html/>",
+	}
+}
+
+func resultsZip(t *testing.T, entries map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, contents := range entries {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		f.Write([]byte(contents))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func checkValidationSummary(t *testing.T, summary *validationSummary) {
+	if summary.Reports != 1 || summary.Counts["error"] != 12 || summary.Counts["warning"] != 1 || !summary.Invalid {
+		t.Errorf("Wrong summary %+v", summary)
+	}
+	if len(summary.Errors) != REPORT_ERRORS {
+		t.Errorf("Wrong number of errors listed %v", len(summary.Errors))
+	}
+	if where := summary.Errors[1].where(); where != "book.xml:20:3" {
+		t.Errorf("Wrong location %v", where)
+	}
+	md := summary.markdown()
+	for _, exp := range []string{"**Validation failed**: 12 errors, 1 warning\n", "* `book.xml:10:3` Error\\_1\n", "_and 2 more errors_"} {
+		if !strings.Contains(md, exp) {
+			t.Errorf("%q not found in the summary\n%v", exp, md)
+		}
+	}
+}
+
+func TestReadValidationReports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dp2_report")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{}
+	for name, contents := range validationResults(12) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		ioutil.WriteFile(file, []byte(contents), 0644)
+		files = append(files, file)
+	}
+	//not written by the job
+	ioutil.WriteFile(filepath.Join(dir, "xml-report", "old.xml"), []byte(validationReport(3, 0)), 0644)
+	summary, err := readValidationReports(dir, files)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkValidationSummary(t, summary)
+}
+
+func TestReadValidationReportsZipped(t *testing.T) {
+	file, err := ioutil.TempFile("", "dp2_report")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(resultsZip(t, validationResults(12)))
+	file.Close()
+	summary, err := readZippedValidationReports(file.Name())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkValidationSummary(t, summary)
+}
+
+func TestValidationSummaryPassed(t *testing.T) {
+	summary := newValidationSummary()
+	if err := summary.read(strings.NewReader(validationReport(0, 2))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if summary.failed() {
+		t.Errorf("Warnings shouldn't fail the validation")
+	}
+	if md := summary.markdown(); !strings.HasPrefix(md, "**Validation passed**: 0 errors, 2 warnings") {
+		t.Errorf("Wrong summary %v", md)
+	}
+	if md := newValidationSummary().markdown(); !strings.Contains(md, "No validation report") {
+		t.Errorf("Wrong summary without reports %v", md)
+	}
+}
+
+func TestReportScriptCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dp2_report")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cli, link := makeSubmitCli(t)
+	p := link.pipeline.(*PipelineTest)
+	p.val = resultsZip(t, validationResults(12))
+	p.delete = func(string) (bool, error) { return true, nil }
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err = cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "-o", filepath.Join(dir, "out"), "--report"})
+	if ExitCode(err) != EXIT_INVALID {
+		t.Errorf("Expected the validation exit code, got %v (%v)", ExitCode(err), err)
+	}
+	if !strings.Contains(buf.String(), "Validation failed") {
+		t.Errorf("The summary wasn't printed\n%v", buf.String())
+	}
+}
+
+func TestReportBackground(t *testing.T) {
+	cli, link := makeSubmitCli(t)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err := cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--background", "--report"})
+	if err == nil || !strings.Contains(err.Error(), "--report") {
+		t.Errorf("Expected error for --report in the background, got %v", err)
+	}
+}
+
+//Checks that the reports left in the output by previous jobs aren't counted
+func TestReportSkipExisting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dp2_report")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	for name, contents := range map[string]string{"xml-report/report.xml": validationReport(0, 0), "xml-report/old.xml": validationReport(3, 0)} {
+		file := filepath.Join(out, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		ioutil.WriteFile(file, []byte(contents), 0644)
+	}
+	cli, link := makeSubmitCli(t)
+	p := link.pipeline.(*PipelineTest)
+	p.val = resultsZip(t, validationResults(12))
+	p.delete = func(string) (bool, error) { return true, nil }
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err = cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "-o", out, "--skip-existing", "--report"})
+	//the report of the job is skipped, only its status is read
+	if ExitCode(err) != EXIT_INVALID || !strings.Contains(err.Error(), "The validation failed") {
+		t.Errorf("Expected the validation exit code without errors counted, got %v (%v)", ExitCode(err), err)
+	}
+	if strings.Contains(buf.String(), "3 errors") {
+		t.Errorf("The old report was read\n%v", buf.String())
+	}
+}
+
+func TestReportJobError(t *testing.T) {
+	cli, link := makeSubmitCli(t)
+	p := link.pipeline.(*PipelineTest)
+	p.job = func(string) (pipeline.Job, error) { return JOB_3, nil }
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	cli.Output = &buf
+	err := cli.Run([]string{"test", "-d", createDataZip(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "-o", os.TempDir(), "--report"})
+	if ExitCode(err) != EXIT_JOB_ERROR {
+		t.Errorf("Expected the job error exit code, got %v (%v)", ExitCode(err), err)
+	}
+	if !strings.Contains(buf.String(), "No validation report as the job finished with status ERROR") {
+		t.Errorf("The missing report wasn't reported\n%v", buf.String())
+	}
+}
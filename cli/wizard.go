@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/capitancambio/blackterm"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Asks the questions of the wizard and reads the answers
+type wizard struct {
+	in   *bufio.Reader
+	out  io.Writer
+	link *PipelineLink
+	args []string //flags of the equivalent command, in the order they were answered
+}
+
+//Prints the question and returns the answer without surrounding spaces
+func (w *wizard) ask(question string) (string, error) {
+	fmt.Fprint(w.out, question)
+	line, err := w.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", errors.New("wizard cancelled")
+	} else if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+//Repeats the question until check accepts the answer, the reasons why it's
+//not accepted are shown
+func (w *wizard) askUntil(question string, check func(string) error) (string, error) {
+	for {
+		answer, err := w.ask(question)
+		if err != nil {
+			return "", err
+		}
+		if err = check(answer); err == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "%v\n", err)
+	}
+}
+
+//Asks a yes/no question, no by default
+func (w *wizard) confirm(question string) (bool, error) {
+	answer, err := w.ask(question + " [y/N] ")
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+//Lists the scripts and asks for one, by number or by name
+func (w *wizard) chooseScript(scripts []pipeline.Script) (id string, err error) {
+	sort.Sort(scriptsById(scripts))
+	for idx, script := range scripts {
+		fmt.Fprintf(w.out, "%3d. %v\t%v\n", idx+1, script.Id, script.Nicename)
+	}
+	_, err = w.askUntil("Script (number or name): ", func(answer string) error {
+		if n, err := strconv.Atoi(answer); err == nil && n > 0 && n <= len(scripts) {
+			id = scripts[n-1].Id
+			return nil
+		}
+		for _, script := range scripts {
+			if script.Id == answer {
+				id = answer
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not a script, type its number or its name", answer)
+	})
+	return
+}
+
+//Shows what the input or option is about
+func (w *wizard) describe(flag, niceName, shortDesc, values string) {
+	if niceName == "" {
+		niceName = flag
+	}
+	fmt.Fprintf(w.out, "\n%v (--%v)\n", niceName, flag)
+	if shortDesc != "" {
+		fmt.Fprintln(w.out, blackterm.MarkdownString(shortDesc))
+	}
+	fmt.Fprintln(w.out, blackterm.MarkdownString("Possible values: "+values))
+}
+
+//Asks for the files of the input and adds them to the request, flag is the
+//name of the input in the script command
+func (w *wizard) askInput(req *JobRequest, input pipeline.Input, flag string) error {
+	values := "A _FILE_"
+	if input.Sequence {
+		values = "One or more _FILES_ separated by commas"
+	}
+	w.describe(flag, input.NiceName, input.ShortDesc, values)
+	answer, err := w.askUntil("File: ", func(answer string) error {
+		if answer == "" {
+			if input.Required {
+				return errors.New("This input is required")
+			}
+			return nil
+		}
+		delete(req.Inputs, input.Name)
+		delete(req.Batch, input.Name)
+		if err := inputFunc(req, w.link, input.Sequence)(input.Name, answer); err != nil {
+			return err
+		}
+		if len(req.Inputs[input.Name]) == 0 {
+			return errors.New("Sets of files are not supported by the wizard, use --batch instead")
+		}
+		return nil
+	})
+	if err == nil && answer != "" {
+		w.args = append(w.args, "--"+flag, answer)
+	}
+	return err
+}
+
+//Asks for the value of the option, checking it with validateOption, and adds
+//it to the request. Optional options keep their default if nothing is typed
+func (w *wizard) askOption(req *JobRequest, option pipeline.Option, flag string) error {
+	w.describe(flag, option.NiceName, option.ShortDesc, optionTypeToDetailedHelp(option.Type))
+	question := "Value: "
+	if !option.Required && option.Default != "" {
+		question = fmt.Sprintf("Value [%v]: ", option.Default)
+	} else if !option.Required {
+		question = "Value (optional): "
+	}
+	answer, err := w.askUntil(question, func(answer string) error {
+		if answer == "" {
+			if option.Required {
+				return errors.New("This option is required")
+			}
+			return nil
+		}
+		delete(req.Options, option.Name)
+		return optionFunc(req, w.link, option.Type, option.Sequence)(option.Name, answer)
+	})
+	if err == nil && answer != "" {
+		w.args = append(w.args, "--"+flag, answer)
+	}
+	return err
+}
+
+//Returns the command line that runs the same job
+func (w *wizard) commandLine(program, script string) string {
+	words := []string{program, script}
+	for _, arg := range w.args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+//Quotes the argument if the shell would interpret it
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`&|;<>()*?[]{}~#!") {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+type scriptsById []pipeline.Script
+
+func (s scriptsById) Len() int           { return len(s) }
+func (s scriptsById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s scriptsById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+//Adds the wizard command, that asks for the script, its inputs and options
+//and the output folder, prints the equivalent command and runs the job
+func AddWizardCommand(cli *Cli, link *PipelineLink) {
+	cmd := cli.AddCommand("wizard", "Asks step by step for the inputs and options of a script and runs it", func(command string, args ...string) error {
+		if len(args) > 1 {
+			return UsageError{fmt.Errorf("Usage: %v [SCRIPT]", command)}
+		}
+		w := &wizard{in: bufio.NewReader(cli.Input), out: cli.Output, link: link}
+		id := ""
+		if len(args) == 1 {
+			id = args[0]
+		} else {
+			scripts, err := link.ScriptList(false)
+			if err != nil {
+				return err
+			}
+			if id, err = w.chooseScript(scripts); err != nil {
+				return err
+			}
+		}
+		script, err := link.Script(id)
+		if err != nil {
+			return fmt.Errorf("Error loading script %v: %v", id, err)
+		}
+		fmt.Fprintf(w.out, "\n%v\n", blackterm.MarkdownString(script.Description))
+		req := newJobRequest()
+		req.Script = script.Id
+		inputFlags, optionFlags := scriptFlagNames(script)
+		for _, input := range script.Inputs {
+			if input.Required {
+				if err := w.askInput(req, input, inputFlags[input.Name]); err != nil {
+					return err
+				}
+			}
+		}
+		for _, option := range script.Options {
+			if option.Required {
+				if err := w.askOption(req, option, optionFlags[option.Name]); err != nil {
+					return err
+				}
+			}
+		}
+		optional, err := w.confirm("\nSet the optional inputs and options?")
+		if err != nil {
+			return err
+		}
+		if optional {
+			for _, input := range script.Inputs {
+				if !input.Required {
+					if err := w.askInput(req, input, inputFlags[input.Name]); err != nil {
+						return err
+					}
+				}
+			}
+			for _, option := range script.Options {
+				if !option.Required {
+					if err := w.askOption(req, option, optionFlags[option.Name]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		output, err := w.askUntil("\nFolder where to store the results: ", func(answer string) error {
+			if answer == "" {
+				return errors.New("The results folder is required")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		w.args = append(w.args, "-o", output)
+		fmt.Fprintf(w.out, "\nThe same job can be run with:\n\n  %v\n\n", w.commandLine(cli.Parser.Name, script.Id))
+		jExec := jobExecution{
+			link:    link,
+			req:     req,
+			output:  output,
+			verbose: true,
+		}
+		return jExec.run(cli.Output)
+	})
+	cmd.SetArity(-1, "[SCRIPT]")
+}
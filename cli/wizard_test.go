@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWizard(t *testing.T) {
+	defer withScriptCache()()
+	dir, err := ioutil.TempDir("", "dp2_wizard")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	single := filepath.Join(dir, "single.xml")
+	source := filepath.Join(dir, "source.xml")
+	for _, file := range []string{single, source} {
+		ioutil.WriteFile(file, []byte("<doc/>"), 0644)
+	}
+	output := filepath.Join(dir, "results dir")
+	cli, link := makeSubmitCli(t)
+	link.pipeline.(*PipelineTest).withScripts = true
+	AddWizardCommand(cli, link)
+	var buf bytes.Buffer
+	cli.Output = &buf
+	cli.Input = strings.NewReader(strings.Join([]string{
+		"2",           //not a script
+		"1",           //test
+		"",            //required
+		"myfile.xml",  //test-opt
+		"y",           //optional ones
+		single,        //single
+		source,        //source
+		"baz",         //not valid
+		"bar",         //another-opt
+		"",            //output required
+		output,        //output
+	}, "\n") + "\n")
+	if err := cli.Run([]string{"wizard"}); err != nil {
+		t.Fatalf("Unexpected error %v\n%v", err, buf.String())
+	}
+	out := buf.String()
+	for _, exp := range []string{
+		"2 is not a script",
+		"This option is required",
+		"'baz' is not allowed as the value for option --another-opt",
+		"The results folder is required",
+		"test test --test-opt myfile.xml --single " + shellQuote(single) + " --source " + shellQuote(source) + " --another-opt bar -o " + shellQuote(output),
+		"Job  sent to the server",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("%q not found in the output\n%v", exp, out)
+		}
+	}
+}
+
+func TestWizardCancelled(t *testing.T) {
+	defer withScriptCache()()
+	cli, link := makeSubmitCli(t)
+	AddWizardCommand(cli, link)
+	cli.Input = strings.NewReader("")
+	if err := cli.Run([]string{"wizard", "test"}); err == nil || err.Error() != "wizard cancelled" {
+		t.Errorf("Expected the wizard to be cancelled, got %v", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for arg, exp := range map[string]string{
+		"file.xml": "file.xml",
+		"my file":  "'my file'",
+		"it's":     `'it'\''s'`,
+		"":         "''",
+		"a,b\\,c":  `'a,b\,c'`,
+	} {
+		if res := shellQuote(arg); res != exp {
+			t.Errorf("Wrong quoting of %q: %v", arg, res)
+		}
+	}
+}
@@ -31,7 +31,7 @@ func main() {
 
 	if err != nil {
 		fmt.Printf("Error creating client:\n\t%v\n", err)
-		os.Exit(-1)
+		os.Exit(cli.ExitCode(err))
 	}
 
 	cli.AddJobStatusCommand(comm, *link)
@@ -43,8 +43,14 @@ func main() {
 	cli.AddMoveUpCommand(comm, *link)
 	cli.AddMoveDownCommand(comm, *link)
 	cli.AddCleanCommand(comm, *link)
+	cli.AddWaitCommand(comm, *link)
+	cli.AddConfigCommand(comm, *link)
+	cli.AddRunCommand(comm, *link)
+	cli.AddSubmitCommand(comm, link)
+	cli.AddWizardCommand(comm, link)
 	cli.AddHaltCommand(comm, *link)
 	cli.AddVersionCommand(comm, link)
+	cli.AddCompletionCommand(comm, link)
 	//admin commands
 	comm.AddClientListCommand(*link)
 	comm.AddNewClientCommand(*link)
@@ -56,7 +62,9 @@ func main() {
 
 	err = comm.Run(os.Args[1:])
 	if err != nil {
-		fmt.Printf("Error:\n\t%v\n", err)
-		os.Exit(-1)
+		if !comm.WriteError(err) {
+			fmt.Printf("Error:\n\t%v\n", err)
+		}
+		os.Exit(cli.ExitCode(err))
 	}
 }
@@ -0,0 +1,113 @@
+package subcommand
+
+import (
+	"sort"
+	"strings"
+)
+
+//Hidden command called by the shell completion scripts: prog __complete ARGS... WORD
+const COMPLETE_COMMAND = "__complete"
+
+//CompletionKind tells the shell what to complete besides the candidates
+type CompletionKind int
+
+const (
+	CompleteValues CompletionKind = iota //only the candidates
+	CompleteFiles                        //file names
+	CompleteDirs                         //directory names
+)
+
+//Completion describes the values accepted by an option
+type Completion struct {
+	Values []string       //candidate values
+	Kind   CompletionKind //what the shell completes otherwise
+}
+
+//Returns the values starting with word
+func (c Completion) candidates(word string) ([]string, CompletionKind) {
+	return withPrefix(c.Values, word), c.Kind
+}
+
+//Sets the function called when the program is run as "prog __complete ARGS... WORD".
+//The regular parsing doesn't take place, the function receives the arguments and
+//is expected to print the candidates returned by Complete
+func (p *Parser) OnComplete(fn CommandFunction) {
+	p.completeFn = fn
+}
+
+//Complete returns the candidates for the last argument, the word being typed,
+//given the previous ones: commands, flags of the current command or values of
+//the option being given. The PreFlags function of the command found is called
+//so that lazily added flags are there
+func (p *Parser) Complete(args []string) ([]string, CompletionKind) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	words, word := args[:len(args)-1], args[len(args)-1]
+	current := &p.Command
+	for i := 0; i < len(words); i++ {
+		arg := words[i]
+		if strings.HasPrefix(arg, "-") {
+			flag := current.lookupFlag(arg)
+			if flag != nil && flag.Type == Option {
+				if i+1 == len(words) {
+					return flag.Completion.candidates(word)
+				}
+				i++
+			}
+			continue
+		}
+		if current != &p.Command {
+			continue
+		}
+		if arg == p.help.Name {
+			current = &p.help
+		} else if cmd, ok := p.Commands[arg]; ok {
+			if err := cmd.preFlagsFn(); err != nil {
+				return nil, CompleteValues
+			}
+			current = cmd
+		}
+	}
+	if strings.HasPrefix(word, "-") {
+		names := []string{}
+		for _, flag := range current.orderedFlags {
+			names = append(names, "--"+flag.Long)
+		}
+		return withPrefix(names, word), CompleteValues
+	}
+	if current == &p.Command || current == &p.help {
+		return withPrefix(p.commandNames(), word), CompleteValues
+	}
+	return nil, CompleteValues
+}
+
+//Returns the sorted names of the commands, hidden ones (starting with _) are left out
+func (p *Parser) commandNames() []string {
+	names := []string{p.help.Name}
+	for name := range p.Commands {
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Looks the flag up by its long (--flag) or short (-f) name, nil if not found
+func (c *Command) lookupFlag(arg string) *Flag {
+	if strings.HasPrefix(arg, "--") {
+		return c.innerFlagsLong[arg[2:]]
+	}
+	return c.innerFlagsShort[arg[1:]]
+}
+
+func withPrefix(values []string, prefix string) []string {
+	res := []string{}
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			res = append(res, value)
+		}
+	}
+	return res
+}
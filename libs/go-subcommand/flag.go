@@ -34,6 +34,8 @@ type Flag struct {
 	fn func(string, string) error
 	//Says if the flag is optional or mandatory
 	Mandatory bool
+	//Values offered by the shell completion
+	Completion Completion
 }
 
 //Must sets the flag as mandatory. The parser will raise an error in case it isn't present in the arguments
@@ -42,6 +44,11 @@ func (f *Flag) Must(isIt bool) {
 	f.Mandatory = isIt
 }
 
+//SetCompletion sets the values offered by the shell completion for the option
+func (f *Flag) SetCompletion(completion Completion) {
+	f.Completion = completion
+}
+
 //Gets a help friendly flag representation:
 //-o,--option  OPTION           This option does this and that
 //-s,--switch                   This is a switch
@@ -8,8 +8,9 @@ import (
 //Parser contains other commands. It's the data structure and its name should be the program's name.
 type Parser struct {
 	Command
-	Commands map[string]*Command
-	help     Command
+	Commands   map[string]*Command
+	help       Command
+	completeFn CommandFunction
 }
 
 //Sets the help command. There is one default implementation automatically added when the parser is created.
@@ -71,6 +72,9 @@ func (p *Parser) AddCommand(name string, shortDesc string, longDesc string, fn C
 //Errors are returned in case an unknown flag is found or a mandatory flag was not supplied.
 // The set of function calls to be performed are carried in order and once the parsing process is done
 func (p *Parser) Parse(args []string) (leftOvers []string, err error) {
+	if len(args) > 0 && args[0] == COMPLETE_COMMAND && p.completeFn != nil {
+		return nil, p.completeFn(COMPLETE_COMMAND, args[1:]...)
+	}
 	err = p.parse(args, p.Command)
 	if err != nil {
 		return
@@ -114,6 +118,9 @@ func (p *Parser) parse(args []string, currentCommand Command) (err error) {
 					if isHelp {
 						cmd = &(p.help)
 					}
+					if err := cmd.preFlagsFn(); err != nil {
+						return err
+					}
 					//call with the rest of the args
 					err := p.parse(args[i+1:], *cmd)
 					if err != nil {
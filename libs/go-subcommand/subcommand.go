@@ -20,6 +20,7 @@ type Command struct {
 	orderedFlags    []*Flag //so we keep the order of the flags
 	fn              CommandFunction
 	postFlagsFn     func() error
+	preFlagsFn      func() error
 	parent          *Command
 	arity           Arity
 }
@@ -74,6 +75,7 @@ func newCommand(parent *Command, name string, shortDesc string, longDesc string,
 		innerFlagsLong:  make(map[string]*Flag),
 		fn:              fn,
 		postFlagsFn:     func() error { return nil },
+		preFlagsFn:      func() error { return nil },
 		ShortDesc :      shortDesc,
 		LongDesc :       longDesc,
 		parent:          parent,
@@ -111,6 +113,12 @@ func (c *Command) AddSwitch(long string, short string, shortDesc string, fn Flag
 	return flag
 }
 
+//Execute this function once the command is found and before its flags are parsed. This can be used
+//to lazily add the flags to commands that are expensive to build
+func (c *Command) PreFlags(fn func() error) {
+	c.preFlagsFn = fn
+}
+
 type Arity struct {
 	Count       int
 	Description string